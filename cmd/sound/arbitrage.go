@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/arbitrage"
+)
+
+func ArbitrageLoop(opps <-chan []*arbitrage.Opportunity, w io.StringWriter, wg *sync.WaitGroup) {
+	var b strings.Builder
+	for oo := range opps {
+		b.Reset()
+		for _, opp := range oo {
+			event := "CLOSE"
+			if opp.Open {
+				event = "OPEN"
+			}
+			fmt.Fprintf(&b, "A %s,%s,%s,%s,%s,%s,%s,%s,%.2f,%s,%d,%.2f,%s\n",
+				formatTime(opp.Timestamp),
+				opp.Pair,
+				event,
+				opp.Buy,
+				opp.Sell,
+				formatFloat(opp.Threshold),
+				formatFloat(opp.Ask),
+				formatFloat(opp.Bid),
+				opp.Spread,
+				formatFloat(opp.Size),
+				opp.Duration.Milliseconds(),
+				opp.MaxSpread,
+				formatFloat(opp.MaxSize))
+		}
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
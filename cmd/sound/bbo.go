@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/consolidate"
+)
+
+func BBOLoop(bbos <-chan *consolidate.BBO, w io.StringWriter, wg *sync.WaitGroup) {
+	var b strings.Builder
+	for bbo := range bbos {
+		b.Reset()
+		fmt.Fprintf(&b, "X %s,%s,%s,%s,%s,%s,%s,%s\n",
+			formatTime(bbo.Timestamp),
+			bbo.Pair,
+			strings.Join(bbo.BidExchanges, "+"),
+			bbo.BidPrice,
+			bbo.BidQuantity,
+			strings.Join(bbo.AskExchanges, "+"),
+			bbo.AskPrice,
+			bbo.AskQuantity)
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
@@ -10,22 +10,6 @@ import (
 	"github.com/oerlikon/sounding/internal/exchange"
 )
 
-func Books(listeners []exchange.Listener) []<-chan *exchange.BookUpdate {
-	books := make([]<-chan *exchange.BookUpdate, 0, len(listeners))
-	for _, listener := range listeners {
-		if listener == nil {
-			continue
-		}
-		if bc := listener.Book(); bc != nil {
-			books = append(books, bc)
-		}
-	}
-	if len(books) == 0 {
-		return nil
-	}
-	return books
-}
-
 func BooksLoop(books []<-chan *exchange.BookUpdate, w io.StringWriter, wg *sync.WaitGroup) {
 	cases := make([]reflect.SelectCase, len(books))
 	for i, bc := range books {
@@ -42,28 +26,75 @@ func BooksLoop(books []<-chan *exchange.BookUpdate, w io.StringWriter, wg *sync.
 			continue
 		}
 		b.Reset()
-		bu := value.Interface().(*exchange.BookUpdate)
-		for _, pl := range bu.Bids {
-			fmt.Fprintf(&b, "B %d,%s,%s,%s,%s,%s,%s\n",
-				bu.Timestamp.UnixMilli(),
-				bu.Timestamp.Format("2006-01-02T15:04:05.000Z07:00"),
-				bu.Exchange,
-				strings.ToUpper(bu.Symbol),
-				"BID",
-				pl.Price,
-				pl.Quantity)
-		}
-		for _, pl := range bu.Asks {
-			fmt.Fprintf(&b, "B %d,%s,%s,%s,%s,%s,%s\n",
-				bu.Timestamp.UnixMilli(),
-				bu.Timestamp.Format("2006-01-02T15:04:05.000Z07:00"),
-				bu.Exchange,
-				strings.ToUpper(bu.Symbol),
-				"ASK",
-				pl.Price,
-				pl.Quantity)
+		writeBookUpdate(&b, value.Interface().(*exchange.BookUpdate))
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
+
+func SnapshotsLoop(snapshots <-chan []*exchange.BookUpdate, w io.StringWriter, wg *sync.WaitGroup) {
+	var b strings.Builder
+	for bb := range snapshots {
+		b.Reset()
+		for _, bu := range bb {
+			writeLevels(&b, "S", bu)
 		}
 		w.WriteString(b.String())
 	}
 	wg.Done()
 }
+
+// writeBookUpdate writes bu as B lines. Snapshots are preceded by an N line
+// with numbers of bid and ask levels following, the book being replaced by
+// them, and resets by an R line, the book being cleared. Lines have received
+// time too if set with flags.
+func writeBookUpdate(b *strings.Builder, bu *exchange.BookUpdate) {
+	switch bu.Kind {
+	case exchange.Snapshot:
+		fmt.Fprintf(b, "N %s,%s,%s,%d,%d\n",
+			bookTimes(bu),
+			bu.Exchange,
+			strings.ToUpper(bu.Symbol),
+			len(bu.Bids),
+			len(bu.Asks))
+	case exchange.Reset:
+		fmt.Fprintf(b, "R %s,%s,%s\n",
+			bookTimes(bu),
+			bu.Exchange,
+			strings.ToUpper(bu.Symbol))
+	}
+	writeLevels(b, "B", bu)
+}
+
+// writeLevels writes levels of bu as lines of the given record.
+func writeLevels(b *strings.Builder, record string, bu *exchange.BookUpdate) {
+	times := bookTimes(bu)
+	for _, pl := range bu.Bids {
+		fmt.Fprintf(b, "%s %s,%s,%s,%s,%s,%s\n",
+			record,
+			times,
+			bu.Exchange,
+			strings.ToUpper(bu.Symbol),
+			"BID",
+			pl.Price,
+			pl.Quantity)
+	}
+	for _, pl := range bu.Asks {
+		fmt.Fprintf(b, "%s %s,%s,%s,%s,%s,%s\n",
+			record,
+			times,
+			bu.Exchange,
+			strings.ToUpper(bu.Symbol),
+			"ASK",
+			pl.Price,
+			pl.Quantity)
+	}
+}
+
+func bookTimes(bu *exchange.BookUpdate) string {
+	times := formatTime(bu.Timestamp)
+	if Options.Received {
+		times += "," + formatTime(bu.Received)
+	}
+	return times
+}
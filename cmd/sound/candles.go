@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/candles"
+)
+
+func CandlesLoop(candles <-chan []*candles.Candle, w io.StringWriter, wg *sync.WaitGroup) {
+	var b strings.Builder
+	for cc := range candles {
+		b.Reset()
+		for _, c := range cc {
+			fmt.Fprintf(&b, "C %s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%d\n",
+				formatTime(c.Start),
+				c.Exchange,
+				strings.ToUpper(c.Symbol),
+				formatInterval(c.Interval),
+				c.Open,
+				c.High,
+				c.Low,
+				c.Close,
+				c.Volume,
+				c.BuyVolume,
+				c.SellVolume,
+				c.Trades)
+		}
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
+
+func formatInterval(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return d.String()
+}
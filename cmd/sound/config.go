@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oerlikon/sounding/feed"
+	. "github.com/oerlikon/sounding/internal/common"
+	"github.com/oerlikon/sounding/internal/mainutil"
+)
+
+// Config is what gets read from the file given with --config.
+type Config struct {
+	Instruments []InstrumentConfig     `yaml:"instruments"`
+	Outputs     []OutputConfig         `yaml:"outputs"`
+	Log         LogConfig              `yaml:"log"`
+	Options     map[string]interface{} `yaml:"options"`
+}
+
+type InstrumentConfig struct {
+	Exchange string            `yaml:"exchange" traits:"nz"`
+	Symbol   string            `yaml:"symbol" traits:"nz"`
+	Streams  []string          `yaml:"streams"`
+	Params   map[string]string `yaml:",inline"`
+}
+
+type OutputConfig struct {
+	Path    string   `yaml:"path" traits:"nz"`
+	Records []string `yaml:"records"`
+}
+
+type LogConfig struct {
+	File   string `yaml:"file"`
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+var records = []string{"B", "N", "S", "R", "T", "U", "Q", "M", "L", "O", "C", "V", "X", "A", "W", "F"}
+
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if err := mainutil.LoadConfig(path, config); err != nil {
+		return nil, err
+	}
+	for _, ic := range config.Instruments {
+		if FindString(feed.Exchanges, ic.Exchange) < 0 {
+			return nil, fmt.Errorf("unknown exchange: %s", ic.Exchange)
+		}
+		for _, stream := range ic.Streams {
+			if FindString(feed.Streams, stream) < 0 {
+				return nil, fmt.Errorf("unknown stream for %s:%s: %s", ic.Exchange, ic.Symbol, stream)
+			}
+		}
+	}
+	for _, oc := range config.Outputs {
+		for _, record := range oc.Records {
+			if FindString(records, record) < 0 {
+				return nil, fmt.Errorf("unknown record type for %s: %s", oc.Path, record)
+			}
+		}
+	}
+	for name := range config.Options {
+		if f := flags.Lookup(name); f == nil || name == "config" || name == "help" {
+			return nil, fmt.Errorf("unknown option: %s", name)
+		}
+	}
+	return config, nil
+}
+
+func (ic *InstrumentConfig) Instrument() *feed.Instrument {
+	inst := &feed.Instrument{
+		Exchange: ic.Exchange,
+		Symbol:   ic.Symbol,
+		Params:   ic.Params,
+		Streams:  ic.Streams,
+	}
+	if inst.Params == nil {
+		inst.Params = map[string]string{}
+	}
+	return inst
+}
+
+// ApplyOptions sets flags not set on the command line or from environment
+// from config options and log settings. Lists are given to flags comma separated.
+func (config *Config) ApplyOptions() error {
+	options := map[string]interface{}{}
+	if config.Log.Level != "" {
+		options["log-level"] = config.Log.Level
+	}
+	if config.Log.Format != "" {
+		options["log-format"] = config.Log.Format
+	}
+	for name, value := range config.Options {
+		options[name] = value
+	}
+	for name, value := range options {
+		if flags.Changed(name) {
+			continue
+		}
+		var s string
+		if values, ok := value.([]interface{}); ok {
+			ss := make([]string, len(values))
+			for i, v := range values {
+				ss[i] = fmt.Sprint(v)
+			}
+			s = strings.Join(ss, ",")
+		} else {
+			s = fmt.Sprint(value)
+		}
+		if err := flags.Set(name, s); err != nil {
+			return fmt.Errorf("invalid option %s: %s", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/feed"
+	. "github.com/oerlikon/sounding/internal/common"
+	"github.com/oerlikon/sounding/internal/mainutil"
+)
+
+// Control serves the control API over HTTP on a local address or, if given
+// as unix:path, on a unix socket:
+//
+//	GET    /instruments                     lists instruments and their subscriptions
+//	POST   /instruments?instrument=X        starts listening to X, given like on the command line
+//	DELETE /instruments?instrument=X        stops listening to X
+//	POST   /resync[?instrument=X]           makes books of X, or all, start over from snapshots
+//	GET    /ladder?pair=P[&depth=N]         gets book of P consolidated across exchanges
+//
+// Instruments to add can have streams=books,trades,... to listen to.
+type Control struct {
+	mu      sync.Mutex
+	session *Session
+
+	ln     net.Listener
+	server *http.Server
+}
+
+func StartControl(addr string) (*Control, error) {
+	ln, err := mainutil.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Control{ln: ln}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /instruments", c.list)
+	mux.HandleFunc("POST /instruments", c.add)
+	mux.HandleFunc("DELETE /instruments", c.remove)
+	mux.HandleFunc("POST /resync", c.resync)
+	mux.HandleFunc("GET /ladder", c.ladder)
+	c.server = &http.Server{Handler: mux}
+	go func() {
+		if err := c.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Msg("Control API stopped")
+		}
+	}()
+	logger.Info().Str("addr", ln.Addr().String()).Msg("Serving control API")
+	return c, nil
+}
+
+// Attach makes the control API act on the session, or on none if nil.
+func (c *Control) Attach(s *Session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = s
+}
+
+func (c *Control) Close() error {
+	return c.server.Close()
+}
+
+func (c *Control) current(w http.ResponseWriter) *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == nil {
+		http.Error(w, "no session", http.StatusServiceUnavailable)
+	}
+	return c.session
+}
+
+func (c *Control) list(w http.ResponseWriter, r *http.Request) {
+	s := c.current(w)
+	if s == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Status())
+}
+
+func (c *Control) add(w http.ResponseWriter, r *http.Request) {
+	s := c.current(w)
+	if s == nil {
+		return
+	}
+	inst, err := feed.ParseInstrument(r.FormValue("instrument"))
+	if err == nil {
+		defaultParams(inst)
+		err = inst.Validate()
+	}
+	if streams := r.FormValue("streams"); streams != "" && err == nil {
+		inst.Streams = strings.Split(streams, ",")
+		for _, stream := range inst.Streams {
+			if FindString(feed.Streams, stream) < 0 {
+				err = errors.New("unknown stream: " + stream)
+			}
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.Add(inst); errors.Is(err, ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	logger.Info().Str("instrument", inst.String()).Msg("Added instrument")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (c *Control) remove(w http.ResponseWriter, r *http.Request) {
+	s := c.current(w)
+	if s == nil {
+		return
+	}
+	name := r.FormValue("instrument")
+	if err := s.Remove(name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	logger.Info().Str("instrument", name).Msg("Removed instrument")
+}
+
+func (c *Control) resync(w http.ResponseWriter, r *http.Request) {
+	s := c.current(w)
+	if s == nil {
+		return
+	}
+	if err := s.Resync(r.FormValue("instrument")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+}
+
+func (c *Control) ladder(w http.ResponseWriter, r *http.Request) {
+	s := c.current(w)
+	if s == nil {
+		return
+	}
+	depth := 0
+	if value := r.FormValue("depth"); value != "" {
+		var err error
+		if depth, err = strconv.Atoi(value); err != nil || depth < 0 {
+			http.Error(w, "invalid depth: "+value, http.StatusBadRequest)
+			return
+		}
+	}
+	ladder := s.Ladder(r.FormValue("pair"), depth)
+	if ladder == nil {
+		http.Error(w, "unknown pair: "+r.FormValue("pair"), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ladder)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/features"
+)
+
+func FeaturesLoop(features <-chan []*features.Features, w io.StringWriter, wg *sync.WaitGroup) {
+	var b strings.Builder
+	for ff := range features {
+		b.Reset()
+		for _, f := range ff {
+			fmt.Fprintf(&b, "F %s,%s,%s,%s,%s,%s,%s,%.4f,%s,%s,%s,%s\n",
+				formatTime(f.Timestamp),
+				f.Exchange,
+				strings.ToUpper(f.Symbol),
+				formatFloat(f.Mid),
+				formatFloat(f.Spread),
+				formatFloat(f.SpreadTicks),
+				formatFloat(f.Microprice),
+				f.Imbalance,
+				formatFloat(f.BidDepth),
+				formatFloat(f.AskDepth),
+				formatFloat(f.BidSlope),
+				formatFloat(f.AskSlope))
+		}
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/validate"
+)
+
+func IssuesLoop(issues <-chan []*validate.Issue, w io.StringWriter, wg *sync.WaitGroup) {
+	var b strings.Builder
+	for ii := range issues {
+		b.Reset()
+		for _, issue := range ii {
+			fmt.Fprintf(&b, "V %s,%s,%s,%s,%s\n",
+				formatTime(issue.Timestamp),
+				issue.Exchange,
+				strings.ToUpper(issue.Symbol),
+				issue.Check,
+				strings.ReplaceAll(issue.Detail, ",", ";"))
+		}
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+func LiquidationsLoop(liquidations []<-chan []*exchange.Liquidation, w io.StringWriter, wg *sync.WaitGroup) {
+	cases := make([]reflect.SelectCase, len(liquidations))
+	for i, lc := range liquidations {
+		cases[i] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(lc),
+		}
+	}
+	var b strings.Builder
+	for len(cases) > 0 {
+		n, value, ok := reflect.Select(cases)
+		if !ok {
+			cases = append(cases[:n], cases[n+1:]...)
+			continue
+		}
+		b.Reset()
+		for _, liq := range value.Interface().([]*exchange.Liquidation) {
+			fmt.Fprintf(&b, "L %s,%s,%s,%s,%s,%s,%s,%s,%s\n",
+				formatTime(liq.Occurred),
+				liq.Exchange,
+				strings.ToUpper(liq.Symbol),
+				func() string {
+					if liq.Side == exchange.Buy {
+						return "BUY"
+					}
+					return "SELL"
+				}(),
+				liq.Price,
+				liq.AvgPrice,
+				liq.Quantity,
+				liq.Filled,
+				liq.Status)
+		}
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
@@ -1,11 +1,47 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/term"
 )
 
 var (
 	stdout = log.New(os.Stdout, "", 0)
-	stderr = log.New(os.Stderr, "", log.Ltime|log.Lmicroseconds)
+	logger = zerolog.New(consoleWriter(os.Stderr)).With().Timestamp().Logger()
 )
+
+func init() {
+	zerolog.TimeFieldFormat = "2006-01-02T15:04:05.000000Z07:00"
+	zerolog.TimestampFunc = func() time.Time { return time.Now().UTC() }
+}
+
+// NewLogger makes a logger writing to w records of the given level and above,
+// either as JSON lines or human readable.
+func NewLogger(w io.Writer, level, format string) (zerolog.Logger, error) {
+	lvl, err := zerolog.ParseLevel(level)
+	if err != nil || lvl == zerolog.NoLevel {
+		return zerolog.Logger{}, fmt.Errorf("invalid log level: %s", level)
+	}
+	switch format {
+	case "json":
+	case "console":
+		w = consoleWriter(w)
+	default:
+		return zerolog.Logger{}, fmt.Errorf("invalid log format: %s", format)
+	}
+	return zerolog.New(w).Level(lvl).With().Timestamp().Logger(), nil
+}
+
+func consoleWriter(w io.Writer) io.Writer {
+	noColor := true
+	if f, ok := w.(*os.File); ok {
+		noColor = !term.IsTerminal(int(f.Fd()))
+	}
+	return zerolog.ConsoleWriter{Out: w, NoColor: noColor, TimeFormat: "15:04:05.000000"}
+}
@@ -1,32 +1,69 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
-	"strings"
+	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	flag "github.com/spf13/pflag"
 	"golang.org/x/term"
 
+	"github.com/oerlikon/sounding/feed"
 	. "github.com/oerlikon/sounding/internal/common"
-	"github.com/oerlikon/sounding/internal/common/syncio"
-	"github.com/oerlikon/sounding/internal/exchange"
-	"github.com/oerlikon/sounding/internal/exchange/binance"
-	"github.com/oerlikon/sounding/internal/exchange/bitfinex"
-	"github.com/oerlikon/sounding/internal/exchange/kraken"
 	"github.com/oerlikon/sounding/internal/mainutil"
 )
 
 var Options struct {
-	Books      bool
-	Trades     bool
-	CPUProfile string
-	Help       bool
+	Books          bool
+	Trades         bool
+	Ticker         bool
+	MarkPrice      bool
+	Liquidations   bool
+	Orders         bool
+	Candles        []time.Duration
+	TradeStats     time.Duration `traits:"ge=0"`
+	StatsInterval  time.Duration `traits:"ge=0"`
+	LargeTrade     float64       `traits:"ge=0"`
+	Dedup          int           `traits:"ge=0"`
+	Conflate       time.Duration `traits:"ge=0"`
+	Snapshots      time.Duration `traits:"ge=0"`
+	SnapshotDepth  int           `traits:"ge=0"`
+	Features       bool
+	FeaturesEvery  time.Duration `traits:"ge=0"`
+	FeatureLevels  int           `traits:"gt=0"`
+	FeatureBps     float64       `traits:"gt=0"`
+	Buffer         int           `traits:"gt=0"`
+	Validate       bool
+	ValidateResync bool
+	Arbitrage      []float64
+	ArbitrageSize  float64 `traits:"ge=0"`
+	TakerFees      map[string]string
+	Overflow       string
+	Received       bool
+	EventTime      bool
+	TimePrecision  string
+	TimeZone       string
+	TimeColumns    string
+	KrakenV2       bool
+	Start          string
+	Until          string
+	Duration       time.Duration `traits:"ge=0"`
+	Daily          bool
+	Output         string
+	Control        string
+	Listen         string
+	ClientBuffer   int `traits:"gt=0"`
+	Config         string
+	LogLevel       string
+	LogFormat      string
+	CPUProfile     string
+	Help           bool
 }
 
 var flags flag.FlagSet
@@ -34,14 +71,52 @@ var flags flag.FlagSet
 func init() {
 	flags.BoolVarP(&Options.Books, "books", "B", true, "books")
 	flags.BoolVarP(&Options.Trades, "trades", "T", true, "trades")
+	flags.BoolVarP(&Options.Ticker, "ticker", "Q", false, "best bid and offer")
+	flags.BoolVarP(&Options.MarkPrice, "markprice", "M", true, "mark price, index price and funding rate")
+	flags.BoolVarP(&Options.Liquidations, "liquidations", "L", true, "liquidation orders")
+	flags.BoolVarP(&Options.Orders, "orders", "O", false, "order level books")
+	flags.DurationSliceVarP(&Options.Candles, "candles", "C", nil, "candle intervals, e.g. 1m,5m")
+	flags.DurationVarP(&Options.TradeStats, "trade-stats", "", 0, "rolling window of trade stats, e.g. 1m, 0 to disable")
+	flags.DurationVarP(&Options.StatsInterval, "stats-interval", "", 0, "trade stats output interval, the window if 0")
+	flags.Float64VarP(&Options.LargeTrade, "large-trade", "", 0, "trade size counted as large in trade stats, 0 to disable")
+	flags.IntVarP(&Options.Dedup, "dedup", "", 10000, "trade deduplication window per instrument, 0 to disable")
+	flags.DurationVarP(&Options.Conflate, "conflate", "", 0, "book update conflation interval, e.g. 100ms, 0 to disable")
+	flags.DurationVarP(&Options.Snapshots, "snapshots", "", 0, "book snapshot interval, e.g. 1m, 0 to disable")
+	flags.IntVarP(&Options.SnapshotDepth, "snapshot-depth", "", 0, "book snapshot levels per side, 0 for all")
+	flags.BoolVarP(&Options.Features, "features", "", false, "book features, imbalance, microprice, depth, slope and spread")
+	flags.DurationVarP(&Options.FeaturesEvery, "features-every", "", 0, "book features sampling interval, 0 for every update")
+	flags.IntVarP(&Options.FeatureLevels, "feature-levels", "", 5, "book levels per side imbalance and slope are of")
+	flags.Float64VarP(&Options.FeatureBps, "feature-bps", "", 10, "distance from mid in bps book depth is within")
+	flags.IntVarP(&Options.Buffer, "buffer", "", 1, "book and trades updates buffered per instrument")
+	flags.StringVarP(&Options.Overflow, "overflow", "", "block", "when buffers are full, block, drop-oldest, coalesce or disconnect")
+	flags.BoolVarP(&Options.Validate, "validate", "", false, "check books and trades, outputting issues found")
+	flags.BoolVarP(&Options.ValidateResync, "validate-resync", "", false, "resync books found crossed or locked, with --validate")
+	flags.Float64SliceVarP(&Options.Arbitrage, "arbitrage", "", nil, "net spread thresholds between exchanges in bps to output crossing of, e.g. 0,10")
+	flags.Float64VarP(&Options.ArbitrageSize, "arbitrage-size", "", 0, "quantity spreads are for, 0 for best bid and ask")
+	flags.StringToStringVarP(&Options.TakerFees, "taker-fees", "", nil, "taker fees in bps by exchange, e.g. binance=10,kraken=26")
+	flags.BoolVarP(&Options.Received, "received", "", false, "received time in book and trade lines, after exchange time")
+	flags.BoolVarP(&Options.EventTime, "event-time", "", false, "trade event time in trade lines, after the time trades occurred")
+	flags.StringVarP(&Options.TimePrecision, "time-precision", "", "ms", "output time precision, ms, us or ns")
+	flags.StringVarP(&Options.TimeZone, "time-zone", "", "utc", "output time zone, utc or local")
+	flags.StringVarP(&Options.TimeColumns, "time-columns", "", "both", "output time columns, both, epoch or iso")
+	flags.BoolVarP(&Options.KrakenV2, "kraken-v2", "", false, "use kraken websocket v2 api")
+	flags.StringVarP(&Options.Start, "start", "", "", "start time, e.g. '2022-11-20 21:00', UTC")
+	flags.StringVarP(&Options.Until, "until", "", "", "end time, UTC")
+	flags.DurationVarP(&Options.Duration, "duration", "", 0, "how long to listen, or daily session length with --daily")
+	flags.BoolVarP(&Options.Daily, "daily", "", false, "listen in daily sessions, rolling output files")
+	flags.StringVarP(&Options.Output, "output", "", "", "output file, {date} gets replaced with session date")
+	flags.StringVarP(&Options.Control, "control", "", "", "control api address, host:port or unix:path")
+	flags.StringVarP(&Options.Listen, "listen", "", "localhost:7071", "feed server address with serve, host:port or unix:path")
+	flags.IntVarP(&Options.ClientBuffer, "client-buffer", "", 10000, "updates buffered per feed server client before it's dropped")
+	flags.StringVarP(&Options.Config, "config", "", "", "config file")
+	flags.StringVarP(&Options.LogLevel, "log-level", "", "info", "log level, debug, info, warn or error")
+	flags.StringVarP(&Options.LogFormat, "log-format", "", "console", "log format, console or json")
 	flags.StringVarP(&Options.CPUProfile, "cpuprofile", "", "", "cpu profile")
 	flags.BoolVarP(&Options.Help, "help", "", false, "this help message")
 	flags.SetInterspersed(false)
 	flags.SetOutput(io.Discard)
 }
 
-var exchanges = []string{"binance", "bitfinex", "kraken"}
-
 func run() (int, error) {
 	if _, err := mainutil.ParseArgs(&flags); err != nil {
 		if err == flag.ErrHelp {
@@ -54,56 +129,91 @@ func run() (int, error) {
 		stdout.Print(flags.FlagUsages())
 		return 1, nil
 	}
+	if err := mainutil.ParseEnv(&flags, "SOUND_"); err != nil {
+		return 1, err
+	}
+	config := &Config{}
+	if Options.Config != "" {
+		var err error
+		if config, err = LoadConfig(Options.Config); err != nil {
+			return 1, err
+		}
+		if err := config.ApplyOptions(); err != nil {
+			return 1, err
+		}
+	}
 	if err := mainutil.Validate(Options); err != nil {
-		stderr.Print(err)
-		return 1, nil
+		return 1, err
 	}
-	if flags.NArg() == 0 {
-		stderr.Print("Symbols?")
-		return 1, nil
+	for _, interval := range Options.Candles {
+		if interval < time.Second {
+			return 1, fmt.Errorf("candle interval shorter than a second: %s", interval)
+		}
+	}
+	fees, err := parseTakerFees(Options.TakerFees)
+	if err != nil {
+		return 1, err
+	}
+	takerFees = fees
+	if outputTime, err = parseTimeFormat(Options.TimePrecision, Options.TimeZone, Options.TimeColumns); err != nil {
+		return 1, err
+	}
+	args := flags.Args()
+	serving := len(args) > 0 && args[0] == "serve"
+	if serving {
+		args = args[1:]
+	}
+	if len(args) == 0 && len(config.Instruments) == 0 && (Options.Control == "" || serving) {
+		return 1, fmt.Errorf("no instruments given")
 	}
 
-	symbols := map[string]string{}
-	for _, arg := range flags.Args() {
-		n := strings.IndexByte(arg, ':')
-		if n < 1 || n > len(arg)-2 {
-			return 1, fmt.Errorf("invalid arg: %s", arg)
-		}
-		exch, sym := arg[:n], arg[n+1:]
-		if FindString(exchanges, exch) < 0 {
-			return 1, fmt.Errorf("unknown exchange: %s", exch)
+	var instruments []*feed.Instrument
+	for _, ic := range config.Instruments {
+		instruments = append(instruments, ic.Instrument())
+	}
+	for _, arg := range args {
+		inst, err := feed.ParseInstrument(arg)
+		if err != nil {
+			return 1, err
 		}
-		if symbols[exch] != "" && symbols[exch] != sym {
-			return 1, fmt.Errorf("more than one symbol for %s: %s", exch, sym)
+		instruments = append(instruments, inst)
+	}
+	sort.SliceStable(instruments, func(i, j int) bool {
+		return FindString(feed.Exchanges, instruments[i].Exchange) < FindString(feed.Exchanges, instruments[j].Exchange)
+	})
+	for i, inst := range instruments {
+		for _, prev := range instruments[:i] {
+			if prev.Exchange == inst.Exchange && prev.Symbol == inst.Symbol {
+				return 1, fmt.Errorf("duplicate instrument: %s", inst)
+			}
 		}
-		symbols[exch] = sym
 	}
 
-	listeners := make([]exchange.Listener, 0, len(exchanges))
-	for _, exch := range exchanges {
-		symbol := symbols[exch]
-		if symbol == "" {
-			continue
-		}
-		switch exch {
-		case "binance":
-			listeners = append(listeners, binance.NewListener(symbol, OptionStderr(stderr)))
-		case "bitfinex":
-			listeners = append(listeners, bitfinex.NewListener(symbol, OptionStderr(stderr)))
-		case "kraken":
-			listeners = append(listeners, kraken.NewListener(symbol, OptionStderr(stderr)))
+	var logw io.Writer = os.Stderr
+	if config.Log.File != "" {
+		f, err := os.OpenFile(config.Log.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return 1, err
 		}
+		logw = f // Kept open till exit, so that errors from main get there too.
 	}
-	if len(listeners) == 0 {
-		stderr.Print("No listeners?")
-		return 1, nil
+	lg, err := NewLogger(logw, Options.LogLevel, Options.LogFormat)
+	if err != nil {
+		return 1, err
+	}
+	logger = lg
+
+	for _, inst := range instruments {
+		defaultParams(inst)
+		if err := inst.Validate(); err != nil {
+			return 1, err
+		}
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	var mu sync.Mutex // Initialization mutex.
-	mu.Lock()
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
@@ -117,38 +227,166 @@ func run() (int, error) {
 		cancel()
 	}()
 
-	for _, listener := range listeners {
-		if err := listener.Start(ctx); err != nil {
-			return 2, err
+	if serving {
+		return serveFeed(ctx, instruments)
+	}
+
+	schedule, err := NewSchedule(Options.Start, Options.Until, Options.Duration, Options.Daily)
+	if err != nil {
+		return 1, err
+	}
+	outputs := config.Outputs
+	if Options.Output != "" {
+		outputs = append(outputs, OutputConfig{Path: Options.Output})
+	}
+
+	var control *Control
+	if Options.Control != "" {
+		if control, err = StartControl(Options.Control); err != nil {
+			return 1, err
 		}
+		defer control.Close()
 	}
 
-	out := bufio.NewWriterSize(os.Stdout, 1*MiB)
-	writer := syncio.NewStringWriter(out)
-	wg := sync.WaitGroup{}
+	for first := true; ; first = false {
+		begin, end, ok := schedule.Next(time.Now())
+		if !ok {
+			if first {
+				return 1, fmt.Errorf("no session to listen in, schedule ends in the past")
+			}
+			break
+		}
+		if wait := time.Until(begin); wait > 0 {
+			logger.Info().Time("begin", begin).Msg("Waiting")
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		mu.Lock()
+		var ret int
+		if instruments, ret, err = session(ctx, schedule, begin, end, instruments, outputs, control, &mu); ret != 0 || err != nil {
+			return ret, err
+		}
+		if !Options.Daily || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return 0, nil
+}
+
+// session listens to instruments from begin till end, or till ctx is done.
+// Daily sessions following one another right away make one session, outputs
+// being rolled over to files of the next date at the boundary. Outputs are
+// flushed and closed at the end of the session, file names having the date
+// in them if daily. The initialization mutex mu is to be locked by the caller
+// and gets unlocked once listening starts. Returns instruments listened to at
+// the end, which may differ from those at the start if control API was used.
+func session(ctx context.Context, schedule *Schedule, begin, end time.Time, instruments []*feed.Instrument, configs []OutputConfig, control *Control, mu *sync.Mutex) ([]*feed.Instrument, int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	if Options.Books {
-		wg.Add(1)
-		go BooksLoop(Books(listeners), writer, &wg)
+	date := ""
+	if Options.Daily {
+		date = begin.Format("2006-01-02")
+	}
+	outputs, err := OpenOutputs(configs, date)
+	if err != nil {
+		mu.Unlock()
+		return nil, 1, err
+	}
+	s, err := StartSession(ctx, instruments, outputs)
+	if err != nil {
+		mu.Unlock()
+		outputs.Close()
+		return nil, 2, err
 	}
-	if Options.Trades {
-		wg.Add(1)
-		go TradesLoop(Trades(listeners), writer, &wg)
+	if control != nil {
+		control.Attach(s)
+		defer control.Attach(nil)
 	}
 
-	stderr.Print("Listening...")
+	if end.IsZero() {
+		logger.Info().Msg("Listening")
+	} else {
+		logger.Info().Time("end", end).Msg("Listening")
+	}
 	mu.Unlock()
 
-	wg.Wait()
-	out.Flush()
+	if end.IsZero() {
+		<-ctx.Done()
+	}
+	for !end.IsZero() {
+		timer := time.NewTimer(time.Until(end))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		if ctx.Err() != nil || !Options.Daily {
+			break
+		}
+		next, nextEnd, ok := schedule.Next(end)
+		if !ok || !next.Equal(end) {
+			break
+		}
+		date = next.Format("2006-01-02")
+		if err := outputs.Roll(date); err != nil {
+			logger.Error().Err(err).Str("date", date).Msg("Rolling outputs over failed")
+		} else {
+			logger.Info().Str("date", date).Msg("Rolled outputs over")
+		}
+		end = nextEnd
+	}
+	cancel()
 
-	return 0, nil
+	s.Wait()
+	if err := outputs.Close(); err != nil {
+		return nil, 2, err
+	}
+
+	return s.Instruments(), 0, nil
+}
+
+// takerFees are taker fees in bps by exchange, as set with flags.
+var takerFees map[string]float64
+
+func parseTakerFees(fees map[string]string) (map[string]float64, error) {
+	parsed := make(map[string]float64, len(fees))
+	for exch, value := range fees {
+		if FindString(feed.Exchanges, exch) < 0 {
+			return nil, fmt.Errorf("unknown exchange: %s", exch)
+		}
+		fee, err := strconv.ParseFloat(value, 64)
+		if err != nil || fee < 0 {
+			return nil, fmt.Errorf("invalid fee for %s: %s", exch, value)
+		}
+		parsed[exch] = fee
+	}
+	return parsed, nil
+}
+
+// defaultParams gives inst buffer and overflow params set with flags, unless
+// it has its own.
+func defaultParams(inst *feed.Instrument) {
+	if _, ok := inst.Params["buffer"]; !ok {
+		inst.Params["buffer"] = strconv.Itoa(Options.Buffer)
+	}
+	if _, ok := inst.Params["overflow"]; !ok {
+		inst.Params["overflow"] = Options.Overflow
+	}
 }
 
 func main() {
 	ret, err := run()
 	if err != nil {
-		stderr.Println("Error:", err)
+		logger.Error().Msg(err.Error())
 	}
 	if ret != 0 {
 		os.Exit(ret)
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+func MarkPriceLoop(markPrices []<-chan *exchange.MarkPriceUpdate, w io.StringWriter, wg *sync.WaitGroup) {
+	cases := make([]reflect.SelectCase, len(markPrices))
+	for i, mc := range markPrices {
+		cases[i] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(mc),
+		}
+	}
+	var b strings.Builder
+	for len(cases) > 0 {
+		n, value, ok := reflect.Select(cases)
+		if !ok {
+			cases = append(cases[:n], cases[n+1:]...)
+			continue
+		}
+		b.Reset()
+		mp := value.Interface().(*exchange.MarkPriceUpdate)
+		fmt.Fprintf(&b, "M %s,%s,%s,%s,%s,%s,%s,%d\n",
+			formatTime(mp.Timestamp),
+			mp.Exchange,
+			strings.ToUpper(mp.Symbol),
+			mp.MarkPrice,
+			mp.IndexPrice,
+			mp.SettlePrice,
+			mp.FundingRate,
+			mp.FundingTime.UnixMilli())
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+func OrdersLoop(orders []<-chan []*exchange.OrderUpdate, w io.StringWriter, wg *sync.WaitGroup) {
+	cases := make([]reflect.SelectCase, len(orders))
+	for i, oc := range orders {
+		cases[i] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(oc),
+		}
+	}
+	var b strings.Builder
+	for len(cases) > 0 {
+		n, value, ok := reflect.Select(cases)
+		if !ok {
+			cases = append(cases[:n], cases[n+1:]...)
+			continue
+		}
+		b.Reset()
+		for _, order := range value.Interface().([]*exchange.OrderUpdate) {
+			if order.Action == exchange.OrderReset {
+				fmt.Fprintf(&b, "O %s,%s,%s,,RESET,,,\n",
+					formatTime(order.Timestamp),
+					order.Exchange,
+					strings.ToUpper(order.Symbol))
+				continue
+			}
+			fmt.Fprintf(&b, "O %s,%s,%s,%d,%s,%s,%s,%s\n",
+				formatTime(order.Timestamp),
+				order.Exchange,
+				strings.ToUpper(order.Symbol),
+				order.OrderID,
+				func() string {
+					switch order.Action {
+					case exchange.OrderAdd:
+						return "ADD"
+					case exchange.OrderModify:
+						return "MODIFY"
+					}
+					return "DELETE"
+				}(),
+				func() string {
+					if order.Side == exchange.Bid {
+						return "BID"
+					}
+					return "ASK"
+				}(),
+				order.Price,
+				order.Quantity)
+		}
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+
+	. "github.com/oerlikon/sounding/internal/common"
+	"github.com/oerlikon/sounding/internal/common/syncio"
+)
+
+// Outputs routes output lines to files by record type, which is the first
+// letter of every line. Lines of record types no output is configured for go
+// to outputs with no record types given, or to stdout if there are none.
+// Files can be rolled over to ones of another date while being written to.
+type Outputs struct {
+	configs []OutputConfig
+
+	mu       sync.RWMutex // Held for writing while rolling over.
+	sinks    []*sink
+	routes   map[byte]*sink
+	fallback *sink
+}
+
+type sink struct {
+	*syncio.StringWriter
+	path string
+	file *os.File
+	buf  *bufio.Writer
+}
+
+func OpenOutputs(configs []OutputConfig, date string) (*Outputs, error) {
+	o := &Outputs{configs: configs}
+	if err := o.openAll(date); err != nil {
+		o.close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// Roll flushes and closes files, opening those of the date in their place.
+// Files that fail to open leave files open as they were.
+func (o *Outputs) Roll(date string) error {
+	other := &Outputs{configs: o.configs}
+	if err := other.openAll(date); err != nil {
+		other.close()
+		return err
+	}
+	o.mu.Lock()
+	o.sinks, other.sinks = other.sinks, o.sinks
+	o.routes, other.routes = other.routes, o.routes
+	o.fallback, other.fallback = other.fallback, o.fallback
+	o.mu.Unlock()
+	return other.close() // Files of the date before now.
+}
+
+func (o *Outputs) openAll(date string) error {
+	o.routes = map[byte]*sink{}
+	for _, oc := range o.configs {
+		sk, err := o.open(datedPath(oc.Path, date))
+		if err != nil {
+			return err
+		}
+		if len(oc.Records) == 0 {
+			o.fallback = sk
+		}
+		for _, record := range oc.Records {
+			o.routes[record[0]] = sk
+		}
+	}
+	if o.fallback == nil && len(o.routes) < len(records) {
+		o.fallback, _ = o.open("-")
+	}
+	return nil
+}
+
+func (o *Outputs) open(path string) (*sink, error) {
+	for _, sk := range o.sinks {
+		if sk.path == path {
+			return sk, nil
+		}
+	}
+	sk := &sink{path: path}
+	if path == "-" {
+		sk.buf = bufio.NewWriterSize(os.Stdout, 1*MiB)
+	} else {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		sk.file, sk.buf = f, bufio.NewWriterSize(f, 1*MiB)
+	}
+	sk.StringWriter = syncio.NewStringWriter(sk.buf)
+	o.sinks = append(o.sinks, sk)
+	return sk, nil
+}
+
+func datedPath(path, date string) string {
+	if path == "-" || date == "" {
+		return path
+	}
+	if strings.Contains(path, "{date}") {
+		return strings.ReplaceAll(path, "{date}", date)
+	}
+	return path + "." + date
+}
+
+func (o *Outputs) route(record byte) *sink {
+	if sk := o.routes[record]; sk != nil {
+		return sk
+	}
+	return o.fallback
+}
+
+func (o *Outputs) WriteString(s string) (n int, err error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if len(o.sinks) == 1 && len(o.routes) == 0 {
+		return o.sinks[0].WriteString(s)
+	}
+	for len(s) > 0 {
+		// Consecutive lines going to the same sink are written at once.
+		sk, i := o.route(s[0]), 0
+		for {
+			j := strings.IndexByte(s[i:], '\n')
+			if j < 0 {
+				i = len(s)
+				break
+			}
+			i += j + 1
+			if i == len(s) || o.route(s[i]) != sk {
+				break
+			}
+		}
+		if sk != nil {
+			m, err := sk.WriteString(s[:i])
+			n += m
+			if err != nil {
+				return n, err
+			}
+		} else {
+			n += i
+		}
+		s = s[i:]
+	}
+	return n, nil
+}
+
+// Close flushes all outputs and closes files.
+func (o *Outputs) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.close()
+}
+
+func (o *Outputs) close() error {
+	var err error
+	for _, sk := range o.sinks {
+		sk.Lock()
+		if e := sk.buf.Flush(); e != nil && err == nil {
+			err = e
+		}
+		sk.Unlock()
+		if sk.file != nil {
+			if e := sk.file.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
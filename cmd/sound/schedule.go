@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/mainutil"
+)
+
+const day = 24 * time.Hour
+
+// Schedule tells when to listen: from start till until or for duration, or in
+// daily sessions, each beginning at start's time of day, midnight by default,
+// and lasting for duration or till the next one begins.
+type Schedule struct {
+	start    time.Time
+	until    time.Time
+	duration time.Duration
+	daily    bool
+}
+
+func NewSchedule(start, until string, duration time.Duration, daily bool) (*Schedule, error) {
+	s := &Schedule{duration: duration, daily: daily}
+	var err error
+	if s.start, err = mainutil.ParseTime(start); err != nil {
+		return nil, fmt.Errorf("invalid start time: %s", start)
+	}
+	if s.until, err = mainutil.ParseTime(until); err != nil {
+		return nil, fmt.Errorf("invalid until time: %s", until)
+	}
+	if !s.start.IsZero() && !s.until.IsZero() && !s.until.After(s.start) {
+		return nil, fmt.Errorf("until time is not after start time")
+	}
+	if daily {
+		if duration > day {
+			return nil, fmt.Errorf("daily session duration is longer than a day")
+		}
+	} else if duration > 0 && !s.until.IsZero() {
+		return nil, fmt.Errorf("both until time and duration given")
+	}
+	return s, nil
+}
+
+// Next returns the session to listen to next as of now. End is zero if the
+// session is not limited in time. Returns false when there are no sessions left.
+func (s *Schedule) Next(now time.Time) (begin, end time.Time, ok bool) {
+	if !s.daily {
+		begin = s.start
+		if begin.IsZero() {
+			begin = now
+		}
+		end = s.until
+		if s.duration > 0 {
+			end = begin.Add(s.duration)
+		}
+		if !end.IsZero() && !end.After(now) {
+			return time.Time{}, time.Time{}, false
+		}
+		return begin, end, true
+	}
+
+	base := s.start
+	if base.IsZero() {
+		base = now.Truncate(day)
+	}
+	length := s.duration
+	if length == 0 {
+		length = day
+	}
+	begin = base
+	if now.After(base) {
+		begin = base.Add(now.Sub(base) / day * day)
+	}
+	end = begin.Add(length)
+	if !end.After(now) {
+		begin, end = begin.Add(day), end.Add(day)
+	}
+	if !s.until.IsZero() {
+		if !begin.Before(s.until) {
+			return time.Time{}, time.Time{}, false
+		}
+		if end.After(s.until) {
+			end = s.until
+		}
+	}
+	return begin, end, true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+
+	"github.com/oerlikon/sounding/feed"
+	"github.com/oerlikon/sounding/feed/feedpb"
+	"github.com/oerlikon/sounding/internal/mainutil"
+	"github.com/oerlikon/sounding/internal/serve"
+)
+
+// serveFeed listens to instruments till ctx is done, serving book updates and
+// trades to gRPC clients instead of writing them out.
+func serveFeed(ctx context.Context, instruments []*feed.Instrument) (int, error) {
+	var streams []string
+	if Options.Books {
+		streams = append(streams, feed.Books)
+	}
+	if Options.Trades {
+		streams = append(streams, feed.Trades)
+	}
+	server := serve.NewServer(Options.ClientBuffer, logger)
+	f, err := feed.New(feed.Config{
+		Instruments: instruments,
+		Streams:     streams,
+		Dedup:       Options.Dedup,
+		Conflate:    Options.Conflate,
+		KrakenV2:    Options.KrakenV2,
+		Logger:      logger,
+	}, server)
+	if err != nil {
+		return 1, err
+	}
+
+	ln, err := mainutil.Listen(Options.Listen)
+	if err != nil {
+		return 1, err
+	}
+	gs := grpc.NewServer()
+	feedpb.RegisterFeedServer(gs, server)
+	done := make(chan error, 1)
+	go func() {
+		done <- gs.Serve(ln)
+	}()
+	logger.Info().Str("addr", ln.Addr().String()).Msg("Serving feed")
+
+	err = f.Run(ctx)
+	server.Close()
+	gs.GracefulStop()
+	if serr := <-done; serr != nil && !errors.Is(serr, grpc.ErrServerStopped) {
+		return 2, serr
+	}
+	if err != nil {
+		return 2, err
+	}
+	return 0, nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/oerlikon/sounding/feed"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Session listens to instruments till its context is done, writing what it
+// gets to outputs. Instruments can be added and removed while it goes on.
+type Session struct {
+	feed *feed.Feed
+
+	books        chan *exchange.BookUpdate
+	snapshots    chan []*feed.BookUpdate
+	trades       chan []*exchange.Trade
+	tickers      chan *exchange.Ticker
+	markPrices   chan *exchange.MarkPriceUpdate
+	liquidations chan []*exchange.Liquidation
+	orders       chan []*exchange.OrderUpdate
+	candles      chan []*feed.Candle
+	issues       chan []*feed.Issue
+	bbos         chan *feed.BBO
+	opps         chan []*feed.Opportunity
+	stats        chan []*feed.TradeStats
+	features     chan []*feed.Features
+
+	wg sync.WaitGroup
+}
+
+var ErrConflict = errors.New("conflict")
+
+type InstrumentStatus struct {
+	Instrument    string           `json:"instrument"`
+	Streams       []string         `json:"streams,omitempty"`
+	Subscriptions []string         `json:"subscriptions"`
+	Received      string           `json:"received,omitempty"`
+	Dropped       int64            `json:"dropped"`
+	Coalesced     int64            `json:"coalesced"`
+	Issues        map[string]int64 `json:"issues,omitempty"`
+}
+
+// StartSession starts listening to instruments, returning once listeners of
+// all have started, or failed to.
+func StartSession(ctx context.Context, instruments []*feed.Instrument, w io.StringWriter) (*Session, error) {
+	streams := []string{feed.Candles}
+	for _, stream := range []struct {
+		name string
+		on   bool
+	}{
+		{feed.Books, Options.Books},
+		{feed.Trades, Options.Trades},
+		{feed.Tickers, Options.Ticker},
+		{feed.MarkPrices, Options.MarkPrice},
+		{feed.Liquidations, Options.Liquidations},
+		{feed.Orders, Options.Orders},
+	} {
+		if stream.on {
+			streams = append(streams, stream.name)
+		}
+	}
+	s := &Session{
+		books:        make(chan *exchange.BookUpdate, 1),
+		snapshots:    make(chan []*feed.BookUpdate, 1),
+		trades:       make(chan []*exchange.Trade, 1),
+		tickers:      make(chan *exchange.Ticker, 1),
+		markPrices:   make(chan *exchange.MarkPriceUpdate, 1),
+		liquidations: make(chan []*exchange.Liquidation, 1),
+		orders:       make(chan []*exchange.OrderUpdate, 1),
+		candles:      make(chan []*feed.Candle, 1),
+		issues:       make(chan []*feed.Issue, 1),
+		bbos:         make(chan *feed.BBO, 1),
+		opps:         make(chan []*feed.Opportunity, 1),
+		stats:        make(chan []*feed.TradeStats, 1),
+		features:     make(chan []*feed.Features, 1),
+	}
+	f, err := feed.New(feed.Config{
+		Instruments:    instruments,
+		Streams:        streams,
+		KrakenV2:       Options.KrakenV2,
+		Dedup:          Options.Dedup,
+		Conflate:       Options.Conflate,
+		Snapshots:      Options.Snapshots,
+		SnapshotDepth:  Options.SnapshotDepth,
+		Candles:        Options.Candles,
+		Validate:       Options.Validate,
+		ValidateResync: Options.ValidateResync,
+		Consolidate:    true,
+		TradeStats:     Options.TradeStats,
+		StatsInterval:  Options.StatsInterval,
+		LargeTrade:     Options.LargeTrade,
+		Features:       Options.Features,
+		FeaturesEvery:  Options.FeaturesEvery,
+		FeatureLevels:  Options.FeatureLevels,
+		FeatureBps:     Options.FeatureBps,
+		Arbitrage:      Options.Arbitrage,
+		ArbitrageSize:  Options.ArbitrageSize,
+		TakerFees:      takerFees,
+		Logger:         logger,
+	}, s)
+	if err != nil {
+		return nil, err
+	}
+	s.feed = f
+
+	s.wg.Add(13)
+	go BooksLoop([]<-chan *exchange.BookUpdate{s.books}, w, &s.wg)
+	go SnapshotsLoop(s.snapshots, w, &s.wg)
+	go TradesLoop([]<-chan []*exchange.Trade{s.trades}, w, &s.wg)
+	go TickersLoop([]<-chan *exchange.Ticker{s.tickers}, w, &s.wg)
+	go MarkPriceLoop([]<-chan *exchange.MarkPriceUpdate{s.markPrices}, w, &s.wg)
+	go LiquidationsLoop([]<-chan []*exchange.Liquidation{s.liquidations}, w, &s.wg)
+	go OrdersLoop([]<-chan []*exchange.OrderUpdate{s.orders}, w, &s.wg)
+	go CandlesLoop(s.candles, w, &s.wg)
+	go IssuesLoop(s.issues, w, &s.wg)
+	go BBOLoop(s.bbos, w, &s.wg)
+	go ArbitrageLoop(s.opps, w, &s.wg)
+	go TradeStatsLoop(s.stats, w, &s.wg)
+	go FeaturesLoop(s.features, w, &s.wg)
+
+	if err := f.Start(ctx); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Session) OnBook(bu *feed.BookUpdate) {
+	s.books <- bu
+}
+
+func (s *Session) OnTrade(trades []*feed.Trade) {
+	s.trades <- trades
+}
+
+func (s *Session) OnEvent(event feed.Event) {
+	switch v := event.(type) {
+	case []*feed.BookUpdate:
+		s.snapshots <- v
+	case *feed.Ticker:
+		s.tickers <- v
+	case *feed.MarkPriceUpdate:
+		s.markPrices <- v
+	case []*feed.Liquidation:
+		s.liquidations <- v
+	case []*feed.OrderUpdate:
+		s.orders <- v
+	case []*feed.Candle:
+		s.candles <- v
+	case []*feed.Issue:
+		s.issues <- v
+	case *feed.BBO:
+		s.bbos <- v
+	case []*feed.Opportunity:
+		s.opps <- v
+	case []*feed.TradeStats:
+		s.stats <- v
+	case []*feed.Features:
+		s.features <- v
+	}
+}
+
+// Add starts listening to the instrument.
+func (s *Session) Add(inst *feed.Instrument) error {
+	err := s.feed.Add(inst)
+	if errors.Is(err, feed.ErrDuplicate) || errors.Is(err, feed.ErrNotRunning) {
+		return fmt.Errorf("%w: %v", ErrConflict, err)
+	}
+	return err
+}
+
+// Remove stops listening to the named instrument, given as exchange:symbol.
+func (s *Session) Remove(name string) error {
+	return s.feed.Remove(name)
+}
+
+// Resync makes books of the named instrument, or all if no name given, start
+// over from snapshots.
+func (s *Session) Resync(name string) error {
+	return s.feed.Resync(name)
+}
+
+// Instruments returns instruments being listened to.
+func (s *Session) Instruments() []*feed.Instrument {
+	return s.feed.Instruments()
+}
+
+func (s *Session) Status() []*InstrumentStatus {
+	statuses := make([]*InstrumentStatus, 0)
+	for _, st := range s.feed.Status() {
+		status := &InstrumentStatus{
+			Instrument:    st.Instrument.String(),
+			Streams:       st.Instrument.Streams,
+			Subscriptions: st.Listener.Subscriptions,
+			Dropped:       st.Listener.Dropped,
+			Coalesced:     st.Listener.Coalesced,
+			Issues:        st.Issues,
+		}
+		if status.Subscriptions == nil {
+			status.Subscriptions = []string{}
+		}
+		if st.Listener.Received != 0 {
+			status.Received = st.Listener.Received.Format("2006-01-02T15:04:05.000Z07:00")
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Wait waits for the session to be over and everything received to be written.
+func (s *Session) Wait() {
+	s.feed.Wait()
+	s.close()
+}
+
+// Ladder returns the book of the pair consolidated across exchanges, up to
+// depth levels of it on each side, or nil if no instruments are mapped to it.
+func (s *Session) Ladder(pair string, depth int) *feed.Ladder {
+	return s.feed.Ladder(pair, depth)
+}
+
+// close closes channels of outputs, waiting for what's in them to be written.
+func (s *Session) close() {
+	close(s.books)
+	close(s.snapshots)
+	close(s.trades)
+	close(s.tickers)
+	close(s.markPrices)
+	close(s.liquidations)
+	close(s.orders)
+	close(s.candles)
+	close(s.issues)
+	close(s.bbos)
+	close(s.opps)
+	close(s.stats)
+	close(s.features)
+	s.wg.Wait()
+}
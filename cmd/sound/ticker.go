@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+func TickersLoop(tickers []<-chan *exchange.Ticker, w io.StringWriter, wg *sync.WaitGroup) {
+	cases := make([]reflect.SelectCase, len(tickers))
+	for i, tc := range tickers {
+		cases[i] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(tc),
+		}
+	}
+	var b strings.Builder
+	for len(cases) > 0 {
+		n, value, ok := reflect.Select(cases)
+		if !ok {
+			cases = append(cases[:n], cases[n+1:]...)
+			continue
+		}
+		b.Reset()
+		ticker := value.Interface().(*exchange.Ticker)
+		fmt.Fprintf(&b, "Q %s,%s,%s,%s,%s,%s,%s\n",
+			formatTime(ticker.Timestamp),
+			ticker.Exchange,
+			strings.ToUpper(ticker.Symbol),
+			ticker.BidPrice,
+			ticker.BidQuantity,
+			ticker.AskPrice,
+			ticker.AskQuantity)
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
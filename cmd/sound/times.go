@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+)
+
+// timeFormat is how times are written in output lines, as set with flags:
+// epoch time, ISO time or both, with the given precision, in UTC or local zone.
+type timeFormat struct {
+	precision time.Duration
+	layout    string
+	local     bool
+	epoch     bool
+	iso       bool
+}
+
+var outputTime = timeFormat{
+	precision: time.Millisecond,
+	layout:    "2006-01-02T15:04:05.000Z07:00",
+	epoch:     true,
+	iso:       true,
+}
+
+func parseTimeFormat(precision, zone, columns string) (timeFormat, error) {
+	var tf timeFormat
+	switch precision {
+	case "ms":
+		tf.precision, tf.layout = time.Millisecond, "2006-01-02T15:04:05.000Z07:00"
+	case "us":
+		tf.precision, tf.layout = time.Microsecond, "2006-01-02T15:04:05.000000Z07:00"
+	case "ns":
+		tf.precision, tf.layout = time.Nanosecond, "2006-01-02T15:04:05.000000000Z07:00"
+	default:
+		return tf, fmt.Errorf("unknown time precision: %s", precision)
+	}
+	switch zone {
+	case "utc":
+	case "local":
+		tf.local = true
+	default:
+		return tf, fmt.Errorf("unknown time zone: %s", zone)
+	}
+	switch columns {
+	case "both":
+		tf.epoch, tf.iso = true, true
+	case "epoch":
+		tf.epoch = true
+	case "iso":
+		tf.iso = true
+	default:
+		return tf, fmt.Errorf("unknown time columns: %s", columns)
+	}
+	return tf, nil
+}
+
+// formatTime returns time columns for ts, comma separated if both.
+func formatTime(ts timestamp.T) string {
+	tf := &outputTime
+	var epoch, iso string
+	if tf.epoch {
+		epoch = strconv.FormatInt(int64(ts)/int64(tf.precision), 10)
+	}
+	if tf.iso {
+		t := ts.Time()
+		if tf.local {
+			t = t.Local()
+		}
+		iso = t.Format(tf.layout)
+	}
+	switch {
+	case tf.epoch && tf.iso:
+		return epoch + "," + iso
+	case tf.epoch:
+		return epoch
+	}
+	return iso
+}
@@ -10,22 +10,6 @@ import (
 	"github.com/oerlikon/sounding/internal/exchange"
 )
 
-func Trades(listeners []exchange.Listener) []<-chan []*exchange.Trade {
-	trades := make([]<-chan []*exchange.Trade, 0, len(listeners))
-	for _, listener := range listeners {
-		if listener == nil {
-			continue
-		}
-		if tc := listener.Trades(); tc != nil {
-			trades = append(trades, tc)
-		}
-	}
-	if len(trades) == 0 {
-		return nil
-	}
-	return trades
-}
-
 func TradesLoop(trades []<-chan []*exchange.Trade, w io.StringWriter, wg *sync.WaitGroup) {
 	cases := make([]reflect.SelectCase, len(trades))
 	for i, tc := range trades {
@@ -43,9 +27,21 @@ func TradesLoop(trades []<-chan []*exchange.Trade, w io.StringWriter, wg *sync.W
 		}
 		b.Reset()
 		for _, trade := range value.Interface().([]*exchange.Trade) {
-			fmt.Fprintf(&b, "T %d,%s,%s,%s,%d,%d,%d,%s,%s,%s\n",
-				trade.Occurred.UnixMilli(),
-				trade.Occurred.Format("2006-01-02T15:04:05.000Z07:00"),
+			times := formatTime(trade.Occurred)
+			if Options.EventTime {
+				times += "," + formatTime(trade.Timestamp)
+			}
+			if Options.Received {
+				times += "," + formatTime(trade.Received)
+			}
+			fmt.Fprintf(&b, "%s %s,%s,%s,%d,%d,%d,%s,%s,%s\n",
+				func() string {
+					if trade.Amended {
+						return "U"
+					}
+					return "T"
+				}(),
+				times,
 				trade.Exchange,
 				strings.ToUpper(trade.Symbol),
 				trade.TradeID,
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/tape"
+)
+
+func TradeStatsLoop(stats <-chan []*tape.Stats, w io.StringWriter, wg *sync.WaitGroup) {
+	var b strings.Builder
+	for ss := range stats {
+		b.Reset()
+		for _, st := range ss {
+			fmt.Fprintf(&b, "W %s,%s,%s,%s,%d,%s,%s,%s,%s,%s,%d,%.4f\n",
+				formatTime(st.Timestamp),
+				st.Exchange,
+				strings.ToUpper(st.Symbol),
+				formatInterval(st.Window),
+				st.Trades,
+				formatFloat(st.Volume),
+				formatFloat(st.BuyVolume),
+				formatFloat(st.SellVolume),
+				formatFloat(st.VWAP),
+				formatFloat(st.AverageSize),
+				st.LargeTrades,
+				st.Imbalance)
+		}
+		w.WriteString(b.String())
+	}
+	wg.Done()
+}
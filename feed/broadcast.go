@@ -0,0 +1,29 @@
+package feed
+
+import "github.com/oerlikon/sounding/internal/broadcast"
+
+// Broadcaster lets any number of consumers read book updates and trades of
+// listeners, each through its own channel, with its own buffer. Consumers
+// subscribing late get snapshots of the books first, and ones not keeping up
+// don't hold up the others.
+type Broadcaster = broadcast.Broadcaster
+
+type (
+	Subscriber      = broadcast.Subscriber
+	BroadcastFilter = broadcast.Filter
+	BroadcastUpdate = broadcast.Update
+)
+
+// What's done with updates for subscribers not keeping up.
+const (
+	DropUpdates    = broadcast.Drop       // Drop them, books being sent whole once there's room.
+	DisconnectSlow = broadcast.Disconnect // Unsubscribe the subscriber.
+)
+
+// Broadcast makes a broadcaster of listener, which must have been started.
+// Its Book and Trades channels must not be read from directly anymore.
+func Broadcast(listener Listener) *Broadcaster {
+	b := broadcast.New()
+	b.Pump(listener)
+	return b
+}
@@ -0,0 +1,53 @@
+package feed
+
+import "sync"
+
+// fanin merges channels, which can be added any time, into one. The merged
+// channel gets closed once the fanin is closed and all channels added are.
+// Nil channels are skipped.
+type fanin[T any] struct {
+	out chan T
+
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+}
+
+func newFanin[T any]() *fanin[T] {
+	return &fanin[T]{out: make(chan T, 1)}
+}
+
+func (f *fanin[T]) add(chs ...<-chan T) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	for _, ch := range chs {
+		if ch == nil {
+			continue
+		}
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			for v := range ch {
+				f.out <- v
+			}
+		}()
+	}
+}
+
+func (f *fanin[T]) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.closed = true
+	go func() {
+		f.wg.Wait()
+		close(f.out)
+	}()
+}
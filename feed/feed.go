@@ -0,0 +1,674 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/oerlikon/sounding/internal/arbitrage"
+	"github.com/oerlikon/sounding/internal/book"
+	"github.com/oerlikon/sounding/internal/candles"
+	. "github.com/oerlikon/sounding/internal/common"
+	"github.com/oerlikon/sounding/internal/conflate"
+	"github.com/oerlikon/sounding/internal/consolidate"
+	"github.com/oerlikon/sounding/internal/dedup"
+	"github.com/oerlikon/sounding/internal/exchange"
+	"github.com/oerlikon/sounding/internal/features"
+	"github.com/oerlikon/sounding/internal/tape"
+	"github.com/oerlikon/sounding/internal/validate"
+)
+
+// Config tells a feed what to listen to and how.
+type Config struct {
+	Instruments []*Instrument
+
+	Streams  []string      // Streams for instruments listing none, books and trades if not given.
+	Dedup    int           // Trades remembered per instrument to tell repeated ones, 0 to disable.
+	Conflate time.Duration // Interval to conflate book updates over, 0 to disable.
+	KrakenV2 bool          // Listen to Kraken through its v2 API.
+
+	TradeStats    time.Duration // Rolling window of trade stats, handled as events, 0 to disable.
+	StatsInterval time.Duration // How often trade stats are handled, the window if 0.
+	LargeTrade    float64       // Trade size counted as large in trade stats, 0 to disable.
+
+	Features      bool          // Work out book features, handling them as events.
+	FeaturesEvery time.Duration // Book features sampling interval, 0 for every update.
+	FeatureLevels int           // Book levels per side imbalance and slope are of, 5 if not given.
+	FeatureBps    float64       // Distance from mid in bps book depth is within, 10 if not given.
+
+	Snapshots     time.Duration // Interval to take snapshots of books at, handled as events, 0 to disable.
+	SnapshotDepth int           // Levels per side in snapshots, 0 for all.
+
+	Candles []time.Duration // Intervals to aggregate trades into candles over, handled as events.
+
+	Validate       bool // Check books and trades, handling issues found as events.
+	ValidateResync bool // Resync books found crossed or locked.
+
+	Consolidate bool // Keep books of instruments with pair params across exchanges, handling best bids and offers as events.
+
+	Arbitrage     []float64          // Net spreads between exchanges, in bps, to handle crossing of as events.
+	ArbitrageSize float64            // Quantity spreads are for, 0 for best bid and ask.
+	TakerFees     map[string]float64 // Taker fees in bps by exchange, e.g. "binance".
+
+	Logger zerolog.Logger
+}
+
+// Handler gets everything a feed receives.
+type Handler interface {
+	OnBook(bu *BookUpdate)
+	OnTrade(trades []*Trade)
+	OnEvent(event Event)
+}
+
+// Event is any of *Ticker, *MarkPriceUpdate, []*Liquidation, []*OrderUpdate,
+// []*BookUpdate of snapshots if taking them periodically, []*Candle if
+// building candles, []*Issue if validating, *BBO if consolidating,
+// []*Opportunity if watching spreads for arbitrage, []*TradeStats if keeping
+// trade stats, or []*Features if working out book features.
+type Event interface{}
+
+// HandlerFuncs is a Handler calling whichever of its funcs are set.
+type HandlerFuncs struct {
+	Book  func(bu *BookUpdate)
+	Trade func(trades []*Trade)
+	Event func(event Event)
+}
+
+func (h HandlerFuncs) OnBook(bu *BookUpdate) {
+	if h.Book != nil {
+		h.Book(bu)
+	}
+}
+
+func (h HandlerFuncs) OnTrade(trades []*Trade) {
+	if h.Trade != nil {
+		h.Trade(trades)
+	}
+}
+
+func (h HandlerFuncs) OnEvent(event Event) {
+	if h.Event != nil {
+		h.Event(event)
+	}
+}
+
+// Errors adding instruments.
+var (
+	ErrDuplicate  = errors.New("duplicate instrument")
+	ErrNotRunning = errors.New("feed not running")
+)
+
+type Feed struct {
+	config  Config
+	handler Handler
+
+	mu      sync.Mutex
+	active  []*active       // Instruments listened to, or last listened to once stopped.
+	running *running        // While running.
+	adding  map[string]bool // Instruments being added, by name.
+	done    chan struct{}   // Closed once the feed has stopped.
+}
+
+type active struct {
+	inst     *Instrument
+	listener Listener
+	cancel   context.CancelFunc
+}
+
+// running has what a feed makes to run, updates of instruments added coming
+// in through fanins.
+type running struct {
+	ctx    context.Context
+	closed bool
+
+	books        *fanin[*BookUpdate]
+	trades       *fanin[[]*Trade]
+	tapped       *fanin[[]*Trade] // Trades aggregated into candles and handled.
+	consumed     *fanin[[]*Trade] // Trades aggregated into candles only.
+	tickers      *fanin[*Ticker]
+	markPrices   *fanin[*MarkPriceUpdate]
+	liquidations *fanin[[]*Liquidation]
+	orders       *fanin[[]*OrderUpdate]
+
+	snapshotter  *book.Snapshotter
+	validator    *validate.Validator
+	consolidator *consolidate.Consolidator
+	tape         *tape.Tape
+	extractor    *features.Extractor
+	monitor      *arbitrage.Monitor
+}
+
+func New(config Config, h Handler) (*Feed, error) {
+	for i, inst := range config.Instruments {
+		if err := check(inst); err != nil {
+			return nil, err
+		}
+		for _, prev := range config.Instruments[:i] {
+			if prev.String() == inst.String() {
+				return nil, fmt.Errorf("%w: %s", ErrDuplicate, inst)
+			}
+		}
+	}
+	for _, stream := range config.Streams {
+		if FindString(Streams, stream) < 0 {
+			return nil, fmt.Errorf("unknown stream: %s", stream)
+		}
+	}
+	if config.Streams == nil {
+		config.Streams = []string{Books, Trades}
+	}
+	if config.Dedup < 0 {
+		return nil, fmt.Errorf("negative dedup")
+	}
+	if config.Conflate < 0 {
+		return nil, fmt.Errorf("negative conflate")
+	}
+	if config.Snapshots < 0 || config.SnapshotDepth < 0 {
+		return nil, fmt.Errorf("negative snapshots interval or depth")
+	}
+	for _, interval := range config.Candles {
+		if interval <= 0 {
+			return nil, fmt.Errorf("candle interval not positive: %s", interval)
+		}
+	}
+	if config.TradeStats < 0 || config.StatsInterval < 0 {
+		return nil, fmt.Errorf("negative trade stats window or interval")
+	}
+	if config.LargeTrade < 0 {
+		return nil, fmt.Errorf("negative large trade size")
+	}
+	if config.FeaturesEvery < 0 || config.FeatureLevels < 0 || config.FeatureBps < 0 {
+		return nil, fmt.Errorf("negative features interval, levels or bps")
+	}
+	if config.FeatureLevels == 0 {
+		config.FeatureLevels = 5
+	}
+	if config.FeatureBps == 0 {
+		config.FeatureBps = 10
+	}
+	if config.ArbitrageSize < 0 {
+		return nil, fmt.Errorf("negative arbitrage size")
+	}
+	for exch, fee := range config.TakerFees {
+		if FindString(Exchanges, exch) < 0 {
+			return nil, fmt.Errorf("unknown exchange: %s", exch)
+		}
+		if fee < 0 {
+			return nil, fmt.Errorf("negative taker fee for %s", exch)
+		}
+	}
+	return &Feed{config: config, handler: h, adding: make(map[string]bool)}, nil
+}
+
+// check validates the instrument and streams it lists.
+func check(inst *Instrument) error {
+	if err := inst.Validate(); err != nil {
+		return err
+	}
+	for _, stream := range inst.Streams {
+		if FindString(Streams, stream) < 0 {
+			return fmt.Errorf("unknown stream for %s: %s", inst, stream)
+		}
+	}
+	return nil
+}
+
+// Run listens to instruments till ctx is done, calling the handler for every
+// update received, one call at a time. Instruments can be added and removed
+// while it runs. Returns once listeners have stopped and everything they sent
+// has been handled.
+func (f *Feed) Run(ctx context.Context) error {
+	if err := f.Start(ctx); err != nil {
+		return err
+	}
+	f.Wait()
+	return nil
+}
+
+// Start starts listening to instruments as Run does, returning once listeners
+// of all have started, or failed to, in which case those started are stopped.
+func (f *Feed) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r := &running{
+		ctx:          ctx,
+		books:        newFanin[*BookUpdate](),
+		trades:       newFanin[[]*Trade](),
+		tapped:       newFanin[[]*Trade](),
+		consumed:     newFanin[[]*Trade](),
+		tickers:      newFanin[*Ticker](),
+		markPrices:   newFanin[*MarkPriceUpdate](),
+		liquidations: newFanin[[]*Liquidation](),
+		orders:       newFanin[[]*OrderUpdate](),
+	}
+	var cases []reflect.SelectCase
+	recv := func(ch interface{}) {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	recv(r.books.out)
+	recv(r.trades.out)
+	recv(r.tickers.out)
+	recv(r.markPrices.out)
+	recv(r.liquidations.out)
+	recv(r.orders.out)
+	if len(f.config.Candles) > 0 {
+		builder := candles.NewBuilder(f.config.Candles...)
+		recv(builder.Tap(r.tapped.out))
+		builder.Consume(r.consumed.out)
+		recv(builder.Candles())
+	} else {
+		r.tapped.close()
+		r.consumed.close()
+	}
+
+	var aux []interface{ Close() } // Made by the feed, closed once listeners are done.
+	closeAux := func() {
+		for _, c := range aux {
+			c.Close()
+		}
+	}
+	if f.config.Snapshots > 0 {
+		r.snapshotter = book.NewSnapshotter(f.config.Snapshots, f.config.SnapshotDepth)
+		recv(r.snapshotter.Snapshots())
+		aux = append(aux, r.snapshotter)
+	}
+	if f.config.Validate {
+		r.validator = validate.NewValidator()
+		recv(r.validator.Issues())
+		aux = append(aux, r.validator)
+	}
+	if f.config.Consolidate {
+		r.consolidator = consolidate.NewConsolidator()
+		recv(r.consolidator.BBOs())
+		aux = append(aux, r.consolidator)
+	}
+	if f.config.TradeStats > 0 {
+		interval := f.config.StatsInterval
+		if interval == 0 {
+			interval = f.config.TradeStats
+		}
+		r.tape = tape.NewTape(f.config.TradeStats, interval, f.config.LargeTrade)
+		recv(r.tape.Stats())
+		aux = append(aux, r.tape)
+	}
+	if f.config.Features {
+		r.extractor = features.NewExtractor(f.config.FeatureLevels, f.config.FeatureBps, f.config.FeaturesEvery)
+		recv(r.extractor.Features())
+		aux = append(aux, r.extractor)
+	}
+	if len(f.config.Arbitrage) > 0 {
+		r.monitor = arbitrage.NewMonitor(f.config.Arbitrage, f.config.TakerFees, f.config.ArbitrageSize)
+		recv(r.monitor.Opportunities())
+		aux = append(aux, r.monitor)
+	}
+
+	done := make(chan struct{})
+	f.mu.Lock()
+	f.active, f.running, f.done = nil, r, done
+	f.mu.Unlock()
+	stop := func() {
+		f.mu.Lock()
+		r.closed = true
+		f.mu.Unlock()
+		r.close()
+	}
+	finish := func() {
+		cancel()
+		closeAux()
+		f.mu.Lock()
+		f.running = nil
+		f.mu.Unlock()
+		close(done)
+	}
+
+	go func() {
+		defer finish()
+		for len(cases) > 0 {
+			n, value, ok := reflect.Select(cases)
+			if !ok {
+				cases = append(cases[:n], cases[n+1:]...)
+				if len(cases) == len(aux) {
+					closeAux() // What the feed makes itself is all that's left.
+				}
+				continue
+			}
+			switch v := value.Interface().(type) {
+			case *BookUpdate:
+				f.handler.OnBook(v)
+			case []*Trade:
+				f.handler.OnTrade(v)
+			default:
+				f.handler.OnEvent(v)
+			}
+		}
+	}()
+
+	// Updates get handled while instruments are added, listeners started
+	// first not having to wait for the others.
+	for _, inst := range f.config.Instruments {
+		if err := f.Add(inst); err != nil {
+			// Listeners started so far are stopped, what they've sent handled.
+			cancel()
+			stop()
+			<-done
+			return err
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return nil
+}
+
+// Wait waits for the feed started to stop, everything listeners sent having
+// been handled.
+func (f *Feed) Wait() {
+	f.mu.Lock()
+	done := f.done
+	f.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// Add starts listening to the instrument while the feed runs.
+func (f *Feed) Add(inst *Instrument) error {
+	if err := check(inst); err != nil {
+		return err
+	}
+	name := inst.String()
+	f.mu.Lock()
+	r := f.running
+	if r == nil || r.closed {
+		f.mu.Unlock()
+		return ErrNotRunning
+	}
+	if f.find(name) >= 0 || f.adding[name] {
+		f.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrDuplicate, inst)
+	}
+	f.adding[name] = true
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.adding, name)
+		f.mu.Unlock()
+	}()
+
+	// Listeners start and subscribe to channels without the lock held, talking
+	// to exchanges taking a while.
+	listener, err := inst.NewListener(f.config.Logger, f.config.KrakenV2)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	if err := listener.Start(ctx); err != nil {
+		cancel()
+		return err
+	}
+	c := f.wire(r, inst, listener)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.closed {
+		cancel()
+		c.discard()
+		return ErrNotRunning
+	}
+	f.active = append(f.active, &active{inst: inst, listener: listener, cancel: cancel})
+	c.add()
+	return nil
+}
+
+// chains are channels updates of a listener come from through the stages the
+// feed runs with, and the fanins they go to.
+type chains struct {
+	books        <-chan *BookUpdate
+	trades       <-chan []*Trade
+	tickers      <-chan *Ticker
+	markPrices   <-chan *MarkPriceUpdate
+	liquidations <-chan []*Liquidation
+	orders       <-chan []*OrderUpdate
+
+	r      *running
+	traded *fanin[[]*Trade] // Trades go to, depending on candles being built.
+}
+
+// wire gets channels of the listener, subscribing to streams, and has updates
+// from them go through the stages the feed runs with.
+func (f *Feed) wire(r *running, inst *Instrument, listener Listener) *chains {
+	c := &chains{r: r}
+	streaming := func(stream string) bool {
+		return inst.Streaming(stream, FindString(f.config.Streams, stream) >= 0)
+	}
+	if streaming(Books) {
+		if bc := listener.Book(); bc != nil {
+			if r.validator != nil {
+				var resync func()
+				if f.config.ValidateResync {
+					resync = func() {
+						f.config.Logger.Warn().Str("exchange", listener.Exchange()).Str("symbol", listener.Symbol()).
+							Msg("Book crossed or locked, resyncing")
+						listener.Resync()
+					}
+				}
+				bc = r.validator.Books(bc, resync)
+			}
+			if f.config.Conflate > 0 {
+				bc = conflate.Books(bc, f.config.Conflate)
+			}
+			if r.snapshotter != nil {
+				bc = r.snapshotter.Tap(bc)
+			}
+			if r.extractor != nil {
+				bc = r.extractor.Tap(bc, inst.Tick())
+			}
+			if pair := inst.Pair(); pair != "" {
+				if r.consolidator != nil {
+					bc = r.consolidator.Tap(bc, pair)
+				}
+				if r.monitor != nil {
+					bc = r.monitor.Tap(bc, pair)
+				}
+			}
+			c.books = bc
+		}
+	}
+	withTrades := streaming(Trades)
+	withCandles := len(f.config.Candles) > 0 && streaming(Candles)
+	if withTrades || withCandles {
+		if tc := listener.Trades(); tc != nil {
+			if f.config.Dedup > 0 {
+				tc = dedup.Trades(tc, f.config.Dedup)
+			}
+			if r.validator != nil {
+				tc = r.validator.Trades(tc)
+			}
+			if r.tape != nil {
+				tc = r.tape.Tap(tc)
+			}
+			c.trades = tc
+			switch {
+			case withTrades && withCandles:
+				c.traded = r.tapped
+			case withTrades:
+				c.traded = r.trades
+			default:
+				c.traded = r.consumed
+			}
+		}
+	}
+	if l, ok := listener.(exchange.TickerListener); ok && streaming(Tickers) {
+		c.tickers = l.Ticker()
+	}
+	if l, ok := listener.(exchange.MarkPriceListener); ok && streaming(MarkPrices) {
+		c.markPrices = l.MarkPrice()
+	}
+	if l, ok := listener.(exchange.LiquidationListener); ok && streaming(Liquidations) {
+		c.liquidations = l.Liquidations()
+	}
+	if l, ok := listener.(exchange.OrderListener); ok && streaming(Orders) {
+		c.orders = l.Orders()
+	}
+	return c
+}
+
+// add adds the channels to the fanins. Called with mu held.
+func (c *chains) add() {
+	c.r.books.add(c.books)
+	if c.traded != nil {
+		c.traded.add(c.trades)
+	}
+	c.r.tickers.add(c.tickers)
+	c.r.markPrices.add(c.markPrices)
+	c.r.liquidations.add(c.liquidations)
+	c.r.orders.add(c.orders)
+}
+
+// discard reads the channels till they get closed, for stages not to block.
+func (c *chains) discard() {
+	discard(c.books)
+	discard(c.trades)
+	discard(c.tickers)
+	discard(c.markPrices)
+	discard(c.liquidations)
+	discard(c.orders)
+}
+
+func discard[T any](ch <-chan T) {
+	if ch != nil {
+		go func() {
+			for range ch {
+			}
+		}()
+	}
+}
+
+// Remove stops listening to the named instrument, given as exchange:symbol.
+func (f *Feed) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i := f.find(name)
+	if i < 0 || f.running == nil {
+		return fmt.Errorf("unknown instrument: %s", name)
+	}
+	f.active[i].cancel()
+	f.active = append(f.active[:i], f.active[i+1:]...)
+	return nil
+}
+
+// Resync makes books of the named instrument, or all if no name given, start
+// over from snapshots.
+func (f *Feed) Resync(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if name == "" {
+		for _, a := range f.active {
+			a.listener.Resync()
+		}
+		return nil
+	}
+	i := f.find(name)
+	if i < 0 {
+		return fmt.Errorf("unknown instrument: %s", name)
+	}
+	f.active[i].listener.Resync()
+	return nil
+}
+
+// Instruments returns instruments listened to, or last listened to once the
+// feed has stopped.
+func (f *Feed) Instruments() []*Instrument {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	instruments := make([]*Instrument, len(f.active))
+	for i, a := range f.active {
+		instruments[i] = a.inst
+	}
+	return instruments
+}
+
+// InstrumentStatus is how listening to an instrument goes.
+type InstrumentStatus struct {
+	Instrument *Instrument
+	Listener   *Status          // Of the instrument's listener.
+	Issues     map[string]int64 // Found by check, if validating.
+}
+
+// Status returns status of every instrument listened to.
+func (f *Feed) Status() []*InstrumentStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	statuses := make([]*InstrumentStatus, len(f.active))
+	for i, a := range f.active {
+		statuses[i] = &InstrumentStatus{Instrument: a.inst, Listener: a.listener.Status()}
+		if r := f.running; r != nil && r.validator != nil {
+			statuses[i].Issues = r.validator.Counts(a.listener.Exchange(), a.listener.Symbol())
+		}
+	}
+	return statuses
+}
+
+// Ladder returns the book of the pair consolidated across exchanges, up to
+// depth levels of it on each side, all if depth is 0. Returns nil if the feed
+// isn't running with Consolidate set, or no instruments are mapped to the pair.
+func (f *Feed) Ladder(pair string, depth int) *Ladder {
+	f.mu.Lock()
+	r := f.running
+	f.mu.Unlock()
+
+	if r != nil && r.consolidator != nil {
+		return r.consolidator.Ladder(strings.ToUpper(pair), depth)
+	}
+	return nil
+}
+
+// TradeStats returns stats of trades of exchange and symbol, as given in
+// trades, over the rolling window up to now. Returns nil if the feed isn't
+// running with TradeStats set, or no trades have been seen.
+func (f *Feed) TradeStats(exch, symbol string) *TradeStats {
+	f.mu.Lock()
+	r := f.running
+	f.mu.Unlock()
+
+	if r != nil && r.tape != nil {
+		return r.tape.Current(exch, symbol)
+	}
+	return nil
+}
+
+// find returns index of the named instrument in active ones, -1 if not there.
+// Called with mu held.
+func (f *Feed) find(name string) int {
+	for i, a := range f.active {
+		if a.inst.String() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// close closes fanins, their channels getting closed once those of listeners are.
+func (r *running) close() {
+	r.books.close()
+	r.trades.close()
+	r.tapped.close()
+	r.consumed.close()
+	r.tickers.close()
+	r.markPrices.close()
+	r.liquidations.close()
+	r.orders.close()
+}
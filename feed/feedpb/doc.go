@@ -0,0 +1,5 @@
+// Package feedpb has the protobuf schema of the feed served by sound serve,
+// and the gRPC code generated from it.
+package feedpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative feed.proto
@@ -0,0 +1,763 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: feed.proto
+
+package feedpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Stream int32
+
+const (
+	Stream_STREAM_UNSPECIFIED Stream = 0
+	Stream_STREAM_BOOKS       Stream = 1
+	Stream_STREAM_TRADES      Stream = 2
+)
+
+// Enum value maps for Stream.
+var (
+	Stream_name = map[int32]string{
+		0: "STREAM_UNSPECIFIED",
+		1: "STREAM_BOOKS",
+		2: "STREAM_TRADES",
+	}
+	Stream_value = map[string]int32{
+		"STREAM_UNSPECIFIED": 0,
+		"STREAM_BOOKS":       1,
+		"STREAM_TRADES":      2,
+	}
+)
+
+func (x Stream) Enum() *Stream {
+	p := new(Stream)
+	*p = x
+	return p
+}
+
+func (x Stream) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Stream) Descriptor() protoreflect.EnumDescriptor {
+	return file_feed_proto_enumTypes[0].Descriptor()
+}
+
+func (Stream) Type() protoreflect.EnumType {
+	return &file_feed_proto_enumTypes[0]
+}
+
+func (x Stream) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Stream.Descriptor instead.
+func (Stream) EnumDescriptor() ([]byte, []int) {
+	return file_feed_proto_rawDescGZIP(), []int{0}
+}
+
+type Side int32
+
+const (
+	Side_SIDE_UNSPECIFIED Side = 0
+	Side_SIDE_BID         Side = 1 // Also buy.
+	Side_SIDE_ASK         Side = 2 // Also sell.
+)
+
+// Enum value maps for Side.
+var (
+	Side_name = map[int32]string{
+		0: "SIDE_UNSPECIFIED",
+		1: "SIDE_BID",
+		2: "SIDE_ASK",
+	}
+	Side_value = map[string]int32{
+		"SIDE_UNSPECIFIED": 0,
+		"SIDE_BID":         1,
+		"SIDE_ASK":         2,
+	}
+)
+
+func (x Side) Enum() *Side {
+	p := new(Side)
+	*p = x
+	return p
+}
+
+func (x Side) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Side) Descriptor() protoreflect.EnumDescriptor {
+	return file_feed_proto_enumTypes[1].Descriptor()
+}
+
+func (Side) Type() protoreflect.EnumType {
+	return &file_feed_proto_enumTypes[1]
+}
+
+func (x Side) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Side.Descriptor instead.
+func (Side) EnumDescriptor() ([]byte, []int) {
+	return file_feed_proto_rawDescGZIP(), []int{1}
+}
+
+type BookKind int32
+
+const (
+	BookKind_BOOK_KIND_DELTA    BookKind = 0 // Levels changed, zero quantity ones removed.
+	BookKind_BOOK_KIND_SNAPSHOT BookKind = 1 // Whole book, in place of whatever came before.
+	BookKind_BOOK_KIND_RESET    BookKind = 2 // Book to be cleared, a snapshot to follow.
+)
+
+// Enum value maps for BookKind.
+var (
+	BookKind_name = map[int32]string{
+		0: "BOOK_KIND_DELTA",
+		1: "BOOK_KIND_SNAPSHOT",
+		2: "BOOK_KIND_RESET",
+	}
+	BookKind_value = map[string]int32{
+		"BOOK_KIND_DELTA":    0,
+		"BOOK_KIND_SNAPSHOT": 1,
+		"BOOK_KIND_RESET":    2,
+	}
+)
+
+func (x BookKind) Enum() *BookKind {
+	p := new(BookKind)
+	*p = x
+	return p
+}
+
+func (x BookKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (BookKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_feed_proto_enumTypes[2].Descriptor()
+}
+
+func (BookKind) Type() protoreflect.EnumType {
+	return &file_feed_proto_enumTypes[2]
+}
+
+func (x BookKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use BookKind.Descriptor instead.
+func (BookKind) EnumDescriptor() ([]byte, []int) {
+	return file_feed_proto_rawDescGZIP(), []int{2}
+}
+
+type SubscribeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Exchanges     []string               `protobuf:"bytes,1,rep,name=exchanges,proto3" json:"exchanges,omitempty"`                             // Exchanges like "binance", all if none given.
+	Symbols       []string               `protobuf:"bytes,2,rep,name=symbols,proto3" json:"symbols,omitempty"`                                 // Symbols like "btcusdt", all if none given.
+	Streams       []Stream               `protobuf:"varint,3,rep,packed,name=streams,proto3,enum=sounding.v1.Stream" json:"streams,omitempty"` // Streams, all if none given.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_feed_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_feed_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubscribeRequest) GetExchanges() []string {
+	if x != nil {
+		return x.Exchanges
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetStreams() []Stream {
+	if x != nil {
+		return x.Streams
+	}
+	return nil
+}
+
+type Update struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Update:
+	//
+	//	*Update_Book
+	//	*Update_Trades
+	Update        isUpdate_Update `protobuf_oneof:"update"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Update) Reset() {
+	*x = Update{}
+	mi := &file_feed_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Update) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Update) ProtoMessage() {}
+
+func (x *Update) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Update.ProtoReflect.Descriptor instead.
+func (*Update) Descriptor() ([]byte, []int) {
+	return file_feed_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Update) GetUpdate() isUpdate_Update {
+	if x != nil {
+		return x.Update
+	}
+	return nil
+}
+
+func (x *Update) GetBook() *BookUpdate {
+	if x != nil {
+		if x, ok := x.Update.(*Update_Book); ok {
+			return x.Book
+		}
+	}
+	return nil
+}
+
+func (x *Update) GetTrades() *Trades {
+	if x != nil {
+		if x, ok := x.Update.(*Update_Trades); ok {
+			return x.Trades
+		}
+	}
+	return nil
+}
+
+type isUpdate_Update interface {
+	isUpdate_Update()
+}
+
+type Update_Book struct {
+	Book *BookUpdate `protobuf:"bytes,1,opt,name=book,proto3,oneof"`
+}
+
+type Update_Trades struct {
+	Trades *Trades `protobuf:"bytes,2,opt,name=trades,proto3,oneof"`
+}
+
+func (*Update_Book) isUpdate_Update() {}
+
+func (*Update_Trades) isUpdate_Update() {}
+
+// Timestamps are in nanoseconds since Unix epoch.
+type BookUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Exchange      string                 `protobuf:"bytes,1,opt,name=exchange,proto3" json:"exchange,omitempty"`
+	Symbol        string                 `protobuf:"bytes,2,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Received      int64                  `protobuf:"varint,4,opt,name=received,proto3" json:"received,omitempty"`
+	Bids          []*PriceLevel          `protobuf:"bytes,5,rep,name=bids,proto3" json:"bids,omitempty"`
+	Asks          []*PriceLevel          `protobuf:"bytes,6,rep,name=asks,proto3" json:"asks,omitempty"`
+	Kind          BookKind               `protobuf:"varint,7,opt,name=kind,proto3,enum=sounding.v1.BookKind" json:"kind,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BookUpdate) Reset() {
+	*x = BookUpdate{}
+	mi := &file_feed_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BookUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BookUpdate) ProtoMessage() {}
+
+func (x *BookUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BookUpdate.ProtoReflect.Descriptor instead.
+func (*BookUpdate) Descriptor() ([]byte, []int) {
+	return file_feed_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BookUpdate) GetExchange() string {
+	if x != nil {
+		return x.Exchange
+	}
+	return ""
+}
+
+func (x *BookUpdate) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *BookUpdate) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *BookUpdate) GetReceived() int64 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+func (x *BookUpdate) GetBids() []*PriceLevel {
+	if x != nil {
+		return x.Bids
+	}
+	return nil
+}
+
+func (x *BookUpdate) GetAsks() []*PriceLevel {
+	if x != nil {
+		return x.Asks
+	}
+	return nil
+}
+
+func (x *BookUpdate) GetKind() BookKind {
+	if x != nil {
+		return x.Kind
+	}
+	return BookKind_BOOK_KIND_DELTA
+}
+
+type PriceLevel struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Price         string                 `protobuf:"bytes,1,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity      string                 `protobuf:"bytes,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PriceLevel) Reset() {
+	*x = PriceLevel{}
+	mi := &file_feed_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PriceLevel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PriceLevel) ProtoMessage() {}
+
+func (x *PriceLevel) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PriceLevel.ProtoReflect.Descriptor instead.
+func (*PriceLevel) Descriptor() ([]byte, []int) {
+	return file_feed_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PriceLevel) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+func (x *PriceLevel) GetQuantity() string {
+	if x != nil {
+		return x.Quantity
+	}
+	return ""
+}
+
+type Trades struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Trades        []*Trade               `protobuf:"bytes,1,rep,name=trades,proto3" json:"trades,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Trades) Reset() {
+	*x = Trades{}
+	mi := &file_feed_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Trades) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Trades) ProtoMessage() {}
+
+func (x *Trades) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Trades.ProtoReflect.Descriptor instead.
+func (*Trades) Descriptor() ([]byte, []int) {
+	return file_feed_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Trades) GetTrades() []*Trade {
+	if x != nil {
+		return x.Trades
+	}
+	return nil
+}
+
+type Trade struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Exchange      string                 `protobuf:"bytes,1,opt,name=exchange,proto3" json:"exchange,omitempty"`
+	Symbol        string                 `protobuf:"bytes,2,opt,name=symbol,proto3" json:"symbol,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Received      int64                  `protobuf:"varint,4,opt,name=received,proto3" json:"received,omitempty"`
+	Occurred      int64                  `protobuf:"varint,5,opt,name=occurred,proto3" json:"occurred,omitempty"`
+	TradeId       int64                  `protobuf:"varint,6,opt,name=trade_id,json=tradeId,proto3" json:"trade_id,omitempty"`
+	BuyOrderId    int64                  `protobuf:"varint,7,opt,name=buy_order_id,json=buyOrderId,proto3" json:"buy_order_id,omitempty"`
+	SellOrderId   int64                  `protobuf:"varint,8,opt,name=sell_order_id,json=sellOrderId,proto3" json:"sell_order_id,omitempty"`
+	Price         string                 `protobuf:"bytes,9,opt,name=price,proto3" json:"price,omitempty"`
+	Quantity      string                 `protobuf:"bytes,10,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Taker         Side                   `protobuf:"varint,11,opt,name=taker,proto3,enum=sounding.v1.Side" json:"taker,omitempty"`
+	Amended       bool                   `protobuf:"varint,12,opt,name=amended,proto3" json:"amended,omitempty"` // Corrects a trade sent before with the same id.
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Trade) Reset() {
+	*x = Trade{}
+	mi := &file_feed_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Trade) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Trade) ProtoMessage() {}
+
+func (x *Trade) ProtoReflect() protoreflect.Message {
+	mi := &file_feed_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Trade.ProtoReflect.Descriptor instead.
+func (*Trade) Descriptor() ([]byte, []int) {
+	return file_feed_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Trade) GetExchange() string {
+	if x != nil {
+		return x.Exchange
+	}
+	return ""
+}
+
+func (x *Trade) GetSymbol() string {
+	if x != nil {
+		return x.Symbol
+	}
+	return ""
+}
+
+func (x *Trade) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *Trade) GetReceived() int64 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+func (x *Trade) GetOccurred() int64 {
+	if x != nil {
+		return x.Occurred
+	}
+	return 0
+}
+
+func (x *Trade) GetTradeId() int64 {
+	if x != nil {
+		return x.TradeId
+	}
+	return 0
+}
+
+func (x *Trade) GetBuyOrderId() int64 {
+	if x != nil {
+		return x.BuyOrderId
+	}
+	return 0
+}
+
+func (x *Trade) GetSellOrderId() int64 {
+	if x != nil {
+		return x.SellOrderId
+	}
+	return 0
+}
+
+func (x *Trade) GetPrice() string {
+	if x != nil {
+		return x.Price
+	}
+	return ""
+}
+
+func (x *Trade) GetQuantity() string {
+	if x != nil {
+		return x.Quantity
+	}
+	return ""
+}
+
+func (x *Trade) GetTaker() Side {
+	if x != nil {
+		return x.Taker
+	}
+	return Side_SIDE_UNSPECIFIED
+}
+
+func (x *Trade) GetAmended() bool {
+	if x != nil {
+		return x.Amended
+	}
+	return false
+}
+
+var File_feed_proto protoreflect.FileDescriptor
+
+const file_feed_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"feed.proto\x12\vsounding.v1\"y\n" +
+	"\x10SubscribeRequest\x12\x1c\n" +
+	"\texchanges\x18\x01 \x03(\tR\texchanges\x12\x18\n" +
+	"\asymbols\x18\x02 \x03(\tR\asymbols\x12-\n" +
+	"\astreams\x18\x03 \x03(\x0e2\x13.sounding.v1.StreamR\astreams\"p\n" +
+	"\x06Update\x12-\n" +
+	"\x04book\x18\x01 \x01(\v2\x17.sounding.v1.BookUpdateH\x00R\x04book\x12-\n" +
+	"\x06trades\x18\x02 \x01(\v2\x13.sounding.v1.TradesH\x00R\x06tradesB\b\n" +
+	"\x06update\"\xff\x01\n" +
+	"\n" +
+	"BookUpdate\x12\x1a\n" +
+	"\bexchange\x18\x01 \x01(\tR\bexchange\x12\x16\n" +
+	"\x06symbol\x18\x02 \x01(\tR\x06symbol\x12\x1c\n" +
+	"\ttimestamp\x18\x03 \x01(\x03R\ttimestamp\x12\x1a\n" +
+	"\breceived\x18\x04 \x01(\x03R\breceived\x12+\n" +
+	"\x04bids\x18\x05 \x03(\v2\x17.sounding.v1.PriceLevelR\x04bids\x12+\n" +
+	"\x04asks\x18\x06 \x03(\v2\x17.sounding.v1.PriceLevelR\x04asks\x12)\n" +
+	"\x04kind\x18\a \x01(\x0e2\x15.sounding.v1.BookKindR\x04kind\">\n" +
+	"\n" +
+	"PriceLevel\x12\x14\n" +
+	"\x05price\x18\x01 \x01(\tR\x05price\x12\x1a\n" +
+	"\bquantity\x18\x02 \x01(\tR\bquantity\"4\n" +
+	"\x06Trades\x12*\n" +
+	"\x06trades\x18\x01 \x03(\v2\x12.sounding.v1.TradeR\x06trades\"\xe7\x02\n" +
+	"\x05Trade\x12\x1a\n" +
+	"\bexchange\x18\x01 \x01(\tR\bexchange\x12\x16\n" +
+	"\x06symbol\x18\x02 \x01(\tR\x06symbol\x12\x1c\n" +
+	"\ttimestamp\x18\x03 \x01(\x03R\ttimestamp\x12\x1a\n" +
+	"\breceived\x18\x04 \x01(\x03R\breceived\x12\x1a\n" +
+	"\boccurred\x18\x05 \x01(\x03R\boccurred\x12\x19\n" +
+	"\btrade_id\x18\x06 \x01(\x03R\atradeId\x12 \n" +
+	"\fbuy_order_id\x18\a \x01(\x03R\n" +
+	"buyOrderId\x12\"\n" +
+	"\rsell_order_id\x18\b \x01(\x03R\vsellOrderId\x12\x14\n" +
+	"\x05price\x18\t \x01(\tR\x05price\x12\x1a\n" +
+	"\bquantity\x18\n" +
+	" \x01(\tR\bquantity\x12'\n" +
+	"\x05taker\x18\v \x01(\x0e2\x11.sounding.v1.SideR\x05taker\x12\x18\n" +
+	"\aamended\x18\f \x01(\bR\aamended*E\n" +
+	"\x06Stream\x12\x16\n" +
+	"\x12STREAM_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fSTREAM_BOOKS\x10\x01\x12\x11\n" +
+	"\rSTREAM_TRADES\x10\x02*8\n" +
+	"\x04Side\x12\x14\n" +
+	"\x10SIDE_UNSPECIFIED\x10\x00\x12\f\n" +
+	"\bSIDE_BID\x10\x01\x12\f\n" +
+	"\bSIDE_ASK\x10\x02*L\n" +
+	"\bBookKind\x12\x13\n" +
+	"\x0fBOOK_KIND_DELTA\x10\x00\x12\x16\n" +
+	"\x12BOOK_KIND_SNAPSHOT\x10\x01\x12\x13\n" +
+	"\x0fBOOK_KIND_RESET\x10\x022I\n" +
+	"\x04Feed\x12A\n" +
+	"\tSubscribe\x12\x1d.sounding.v1.SubscribeRequest\x1a\x13.sounding.v1.Update0\x01B*Z(github.com/oerlikon/sounding/feed/feedpbb\x06proto3"
+
+var (
+	file_feed_proto_rawDescOnce sync.Once
+	file_feed_proto_rawDescData []byte
+)
+
+func file_feed_proto_rawDescGZIP() []byte {
+	file_feed_proto_rawDescOnce.Do(func() {
+		file_feed_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_feed_proto_rawDesc), len(file_feed_proto_rawDesc)))
+	})
+	return file_feed_proto_rawDescData
+}
+
+var file_feed_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_feed_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_feed_proto_goTypes = []any{
+	(Stream)(0),              // 0: sounding.v1.Stream
+	(Side)(0),                // 1: sounding.v1.Side
+	(BookKind)(0),            // 2: sounding.v1.BookKind
+	(*SubscribeRequest)(nil), // 3: sounding.v1.SubscribeRequest
+	(*Update)(nil),           // 4: sounding.v1.Update
+	(*BookUpdate)(nil),       // 5: sounding.v1.BookUpdate
+	(*PriceLevel)(nil),       // 6: sounding.v1.PriceLevel
+	(*Trades)(nil),           // 7: sounding.v1.Trades
+	(*Trade)(nil),            // 8: sounding.v1.Trade
+}
+var file_feed_proto_depIdxs = []int32{
+	0, // 0: sounding.v1.SubscribeRequest.streams:type_name -> sounding.v1.Stream
+	5, // 1: sounding.v1.Update.book:type_name -> sounding.v1.BookUpdate
+	7, // 2: sounding.v1.Update.trades:type_name -> sounding.v1.Trades
+	6, // 3: sounding.v1.BookUpdate.bids:type_name -> sounding.v1.PriceLevel
+	6, // 4: sounding.v1.BookUpdate.asks:type_name -> sounding.v1.PriceLevel
+	2, // 5: sounding.v1.BookUpdate.kind:type_name -> sounding.v1.BookKind
+	8, // 6: sounding.v1.Trades.trades:type_name -> sounding.v1.Trade
+	1, // 7: sounding.v1.Trade.taker:type_name -> sounding.v1.Side
+	3, // 8: sounding.v1.Feed.Subscribe:input_type -> sounding.v1.SubscribeRequest
+	4, // 9: sounding.v1.Feed.Subscribe:output_type -> sounding.v1.Update
+	9, // [9:10] is the sub-list for method output_type
+	8, // [8:9] is the sub-list for method input_type
+	8, // [8:8] is the sub-list for extension type_name
+	8, // [8:8] is the sub-list for extension extendee
+	0, // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_feed_proto_init() }
+func file_feed_proto_init() {
+	if File_feed_proto != nil {
+		return
+	}
+	file_feed_proto_msgTypes[1].OneofWrappers = []any{
+		(*Update_Book)(nil),
+		(*Update_Trades)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_feed_proto_rawDesc), len(file_feed_proto_rawDesc)),
+			NumEnums:      3,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_feed_proto_goTypes,
+		DependencyIndexes: file_feed_proto_depIdxs,
+		EnumInfos:         file_feed_proto_enumTypes,
+		MessageInfos:      file_feed_proto_msgTypes,
+	}.Build()
+	File_feed_proto = out.File
+	file_feed_proto_goTypes = nil
+	file_feed_proto_depIdxs = nil
+}
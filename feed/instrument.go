@@ -0,0 +1,243 @@
+package feed
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	. "github.com/oerlikon/sounding/internal/common"
+	"github.com/oerlikon/sounding/internal/exchange"
+	"github.com/oerlikon/sounding/internal/exchange/binance"
+	"github.com/oerlikon/sounding/internal/exchange/binancefutures"
+	"github.com/oerlikon/sounding/internal/exchange/bitfinex"
+	"github.com/oerlikon/sounding/internal/exchange/kraken"
+)
+
+// Exchanges instruments can be listened to at.
+var Exchanges = []string{"binance", "binancefutures", "bitfinex", "kraken"}
+
+// Streams instruments can be listened to for.
+const (
+	Books        = "books"
+	Trades       = "trades"
+	Tickers      = "ticker"
+	MarkPrices   = "markprice"
+	Liquidations = "liquidations"
+	Orders       = "orders"
+	Candles      = "candles" // Trades aggregated into candles, if building them.
+)
+
+var Streams = []string{Books, Trades, Tickers, MarkPrices, Liquidations, Orders, Candles}
+
+// Instrument is a symbol at one of the exchanges, along with exchange specific
+// params, like book depth, and streams to listen to for it. It can be given as
+// exchange:symbol[,param=value...], e.g. bitfinex:btcusd,depth=25,prec=P1.
+// Params buffer and overflow, for book and trades channel capacity and what
+// to do when they're full, are there for all exchanges, and so are pair, the
+// canonical pair the instrument's book is consolidated into across exchanges,
+// and tick, its price tick size.
+type Instrument struct {
+	Exchange string
+	Symbol   string
+	Params   map[string]string
+	Streams  []string // Streams to listen to, or nil for the defaults.
+}
+
+func ParseInstrument(arg string) (*Instrument, error) {
+	spec, params, _ := strings.Cut(arg, ",")
+	n := strings.IndexByte(spec, ':')
+	if n < 1 || n > len(spec)-2 {
+		return nil, fmt.Errorf("invalid arg: %s", arg)
+	}
+	exch, sym := spec[:n], spec[n+1:]
+	if FindString(Exchanges, exch) < 0 {
+		return nil, fmt.Errorf("unknown exchange: %s", exch)
+	}
+	inst := &Instrument{
+		Exchange: exch,
+		Symbol:   sym,
+		Params:   map[string]string{},
+	}
+	if params == "" {
+		return inst, nil
+	}
+	for _, param := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid param for %s: %s", exch, param)
+		}
+		inst.Params[key] = value
+	}
+	return inst, nil
+}
+
+func (inst *Instrument) String() string {
+	return inst.Exchange + ":" + inst.Symbol
+}
+
+// Pair returns the canonical pair the instrument is mapped to, if any.
+func (inst *Instrument) Pair() string {
+	return strings.ToUpper(inst.Params["pair"])
+}
+
+// Tick returns price tick size of the instrument, 0 if not known.
+func (inst *Instrument) Tick() float64 {
+	tick, _ := strconv.ParseFloat(inst.Params["tick"], 64)
+	return tick
+}
+
+// Streaming tells whether the named stream is to be listened to for the instrument,
+// on is what it should be by default.
+func (inst *Instrument) Streaming(stream string, on bool) bool {
+	if inst.Streams == nil {
+		return on
+	}
+	return FindString(inst.Streams, stream) >= 0
+}
+
+// Validate checks the instrument's exchange, symbol and params.
+func (inst *Instrument) Validate() error {
+	if FindString(Exchanges, inst.Exchange) < 0 {
+		return fmt.Errorf("unknown exchange: %s", inst.Exchange)
+	}
+	if inst.Symbol == "" {
+		return fmt.Errorf("no symbol for %s", inst.Exchange)
+	}
+	_, err := inst.options()
+	return err
+}
+
+// NewListener makes a listener for the instrument. Listeners for Kraken use
+// its v2 API if krakenV2 is set.
+func (inst *Instrument) NewListener(logger zerolog.Logger, krakenV2 bool) (Listener, error) {
+	opts, err := inst.options()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, OptionLogger(logger))
+	switch inst.Exchange {
+	case "binance":
+		return binance.NewListener(inst.Symbol, opts...), nil
+	case "binancefutures":
+		return binancefutures.NewListener(inst.Symbol, opts...), nil
+	case "bitfinex":
+		return bitfinex.NewListener(inst.Symbol, opts...), nil
+	case "kraken":
+		if krakenV2 {
+			return kraken.NewListenerV2(inst.Symbol, opts...), nil
+		}
+		return kraken.NewListener(inst.Symbol, opts...), nil
+	}
+	return nil, fmt.Errorf("unknown exchange: %s", inst.Exchange)
+}
+
+// options validates instrument params and translates them to listener options.
+func (inst *Instrument) options() ([]Option, error) {
+	var opts []Option
+	for key, value := range inst.Params {
+		var opt Option
+		var err error
+		switch inst.Exchange + "/" + key {
+		case inst.Exchange + "/buffer":
+			opt, err = bufferOption(value)
+		case inst.Exchange + "/pair":
+			continue
+		case inst.Exchange + "/tick":
+			if tick, err := strconv.ParseFloat(value, 64); err != nil || tick <= 0 {
+				return nil, fmt.Errorf("invalid %s for %s: must be a positive number", key, inst)
+			}
+			continue
+		case inst.Exchange + "/overflow":
+			var overflow exchange.Overflow
+			if overflow, err = exchange.ParseOverflow(value); err != nil {
+				err = fmt.Errorf("must be block, drop-oldest, coalesce or disconnect")
+			}
+			opt = OptionOverflow(overflow)
+		case "binance/depth":
+			opt, err = depthRangeOption(value, 1, 5000)
+		case "binance/speed":
+			opt, err = speedOption(value, 100*time.Millisecond, time.Second)
+		case "binancefutures/depth":
+			opt, err = depthOption(value, 5, 10, 20, 50, 100, 500, 1000)
+		case "binancefutures/speed":
+			opt, err = speedOption(value, 100*time.Millisecond, 250*time.Millisecond, 500*time.Millisecond)
+		case "bitfinex/depth":
+			opt, err = depthOption(value, 1, 25, 100, 250)
+		case "bitfinex/freq":
+			if value != "F0" && value != "F1" {
+				err = fmt.Errorf("must be F0 or F1")
+			}
+			opt = OptionFrequency(value)
+		case "bitfinex/prec":
+			if len(value) != 2 || value[0] != 'P' || value[1] < '0' || value[1] > '4' {
+				err = fmt.Errorf("must be one of P0 to P4")
+			}
+			opt = OptionPrecision(value)
+		case "bitfinex/trades":
+			if value != "all" && value != "final" {
+				err = fmt.Errorf("must be all or final")
+			}
+			opt = OptionFinalTrades(value == "final")
+		case "kraken/depth":
+			opt, err = depthOption(value, 10, 25, 100, 500, 1000)
+		default:
+			return nil, fmt.Errorf("unknown param for %s: %s", inst.Exchange, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for %s: %s", key, inst, err)
+		}
+		opts = append(opts, opt)
+	}
+	return opts, nil
+}
+
+func bufferOption(value string) (Option, error) {
+	buffer, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("not a number")
+	}
+	if buffer < 1 {
+		return nil, fmt.Errorf("must be positive")
+	}
+	return OptionBuffer(buffer), nil
+}
+
+func depthRangeOption(value string, min, max int) (Option, error) {
+	depth, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("not a number")
+	}
+	if depth < min || depth > max {
+		return nil, fmt.Errorf("must be %d to %d", min, max)
+	}
+	return OptionDepth(depth), nil
+}
+
+func depthOption(value string, allowed ...int) (Option, error) {
+	depth, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("not a number")
+	}
+	for _, a := range allowed {
+		if depth == a {
+			return OptionDepth(depth), nil
+		}
+	}
+	return nil, fmt.Errorf("must be one of %s", strings.Trim(fmt.Sprint(allowed), "[]"))
+}
+
+func speedOption(value string, allowed ...time.Duration) (Option, error) {
+	speed, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range allowed {
+		if speed == a {
+			return OptionSpeed(speed), nil
+		}
+	}
+	return nil, fmt.Errorf("must be one of %s", strings.Trim(fmt.Sprint(allowed), "[]"))
+}
@@ -0,0 +1,54 @@
+package feed
+
+import (
+	"github.com/oerlikon/sounding/internal/arbitrage"
+	"github.com/oerlikon/sounding/internal/candles"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/consolidate"
+	"github.com/oerlikon/sounding/internal/exchange"
+	"github.com/oerlikon/sounding/internal/features"
+	"github.com/oerlikon/sounding/internal/tape"
+	"github.com/oerlikon/sounding/internal/validate"
+)
+
+type (
+	Listener       = exchange.Listener
+	TickerListener = exchange.TickerListener
+	Timestamp      = timestamp.T
+	Side           = exchange.Side
+	Status         = exchange.Status
+
+	BookUpdate       = exchange.BookUpdate
+	UpdateKind       = exchange.UpdateKind
+	PriceLevelUpdate = exchange.PriceLevelUpdate
+	Ticker           = exchange.Ticker
+	OrderAction      = exchange.OrderAction
+	OrderUpdate      = exchange.OrderUpdate
+	Trade            = exchange.Trade
+	MarkPriceUpdate  = exchange.MarkPriceUpdate
+	Liquidation      = exchange.Liquidation
+	Candle           = candles.Candle
+	Issue            = validate.Issue
+	BBO              = consolidate.BBO
+	Ladder           = consolidate.Ladder
+	LadderLevel      = consolidate.Level
+	Opportunity      = arbitrage.Opportunity
+	TradeStats       = tape.Stats
+	Features         = features.Features
+)
+
+const (
+	Delta    = exchange.Delta
+	Snapshot = exchange.Snapshot
+	Reset    = exchange.Reset
+
+	Bid  = exchange.Bid
+	Buy  = exchange.Buy
+	Ask  = exchange.Ask
+	Sell = exchange.Sell
+
+	OrderAdd    = exchange.OrderAdd
+	OrderModify = exchange.OrderModify
+	OrderDelete = exchange.OrderDelete
+	OrderReset  = exchange.OrderReset
+)
@@ -0,0 +1,348 @@
+package arbitrage
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/book"
+	"github.com/oerlikon/sounding/internal/common/outbox"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Opportunity is a net spread between buying a pair at one exchange and selling
+// it at another going to a threshold or above, or back below it.
+type Opportunity struct {
+	Pair string
+
+	Timestamp timestamp.T // Of the update the spread changed on.
+	Received  timestamp.T
+
+	Buy       string  // Exchange to buy at.
+	Sell      string  // Exchange to sell at.
+	Threshold float64 // Bps.
+	Open      bool    // Spread at threshold or above.
+
+	Ask    float64 // Price bought at, average over size if set.
+	Bid    float64 // Price sold at, average over size if set.
+	Spread float64 // Bid less ask, net of taker fees, in bps of ask.
+	Size   float64 // Quantity that can be bought and sold at spreads at threshold or above.
+
+	Duration  time.Duration // Since going to threshold or above, by time received.
+	MaxSpread float64       // Over the duration.
+	MaxSize   float64       // Over the duration.
+}
+
+// Monitor keeps books from updates passing through it, by the pair they are
+// mapped to, and watches net spreads between exchanges for every pair, sending
+// opportunities as the spreads cross thresholds.
+type Monitor struct {
+	thresholds []float64
+	fees       map[string]float64
+	size       float64
+
+	mu    sync.Mutex
+	pairs map[string]*pair
+	opps  *outbox.Outbox[[]*Opportunity]
+}
+
+type pair struct {
+	name  string
+	books []*book.Book
+	open  map[route]*Opportunity // Last sent, while open.
+}
+
+type route struct {
+	buy, sell string
+	threshold float64
+}
+
+// NewMonitor makes a monitor reporting spreads crossing thresholds, in bps.
+// Taker fees, in bps, are by lowercase exchange name. If size is set, spreads
+// are of buying and selling that quantity, walking the books, rather than at
+// best bid and ask.
+func NewMonitor(thresholds []float64, fees map[string]float64, size float64) *Monitor {
+	thresholds = slices.Clone(thresholds)
+	slices.Sort(thresholds)
+	return &Monitor{
+		thresholds: thresholds,
+		fees:       fees,
+		size:       size,
+		pairs:      make(map[string]*pair),
+		opps:       outbox.New[[]*Opportunity](16),
+	}
+}
+
+// Tap keeps book of the pair from updates coming from in, passing them through
+// to the returned channel. The book is dropped once in gets closed, spreads
+// open with it being closed.
+func (m *Monitor) Tap(in <-chan *exchange.BookUpdate, name string) <-chan *exchange.BookUpdate {
+	out := make(chan *exchange.BookUpdate, 1)
+	go func() {
+		defer close(out)
+		var b *book.Book
+		for bu := range in {
+			if b == nil {
+				b = m.add(name, bu.Exchange, bu.Symbol)
+			}
+			m.apply(name, b, bu)
+			out <- bu
+		}
+		if b != nil {
+			m.drop(name, b)
+		}
+	}()
+	return out
+}
+
+// Opportunities returns the channel opportunities are sent to, those found at
+// once in one batch.
+func (m *Monitor) Opportunities() <-chan []*Opportunity {
+	return m.opps.C()
+}
+
+// Open returns opportunities open for the pair, all if name is empty.
+func (m *Monitor) Open(name string) []*Opportunity {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var opps []*Opportunity
+	for _, p := range m.pairs {
+		if name != "" && p.name != name {
+			continue
+		}
+		for _, opp := range p.open {
+			opps = append(opps, opp)
+		}
+	}
+	return opps
+}
+
+// Close stops sending opportunities, closing the channel.
+func (m *Monitor) Close() {
+	m.opps.Close()
+}
+
+func (m *Monitor) add(name, exch, symbol string) *book.Book {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.pairs[name]
+	if p == nil {
+		p = &pair{name: name, open: make(map[route]*Opportunity)}
+		m.pairs[name] = p
+	}
+	b := book.New(exch, symbol)
+	p.books = append(p.books, b)
+	return b
+}
+
+func (m *Monitor) apply(name string, b *book.Book, bu *exchange.BookUpdate) {
+	m.mu.Lock()
+
+	b.Apply(bu)
+	p := m.pairs[name]
+	var opps []*Opportunity
+	for _, o := range p.books {
+		if o.Exchange == b.Exchange {
+			continue
+		}
+		opps = append(opps, m.check(p, b, o, bu)...)
+		opps = append(opps, m.check(p, o, b, bu)...)
+	}
+	m.send(opps)
+}
+
+func (m *Monitor) drop(name string, b *book.Book) {
+	m.mu.Lock()
+
+	p := m.pairs[name]
+	for i, o := range p.books {
+		if o == b {
+			p.books = append(p.books[:i], p.books[i+1:]...)
+			break
+		}
+	}
+	var opps []*Opportunity
+	for r, opp := range p.open {
+		if r.buy != b.Exchange && r.sell != b.Exchange {
+			continue
+		}
+		closed := *opp
+		closed.Open = false
+		opps = append(opps, &closed)
+		delete(p.open, r)
+	}
+	if len(p.books) == 0 {
+		delete(m.pairs, name)
+	}
+	m.send(opps)
+}
+
+// send sends opportunities, if any, unlocking mu.
+func (m *Monitor) send(opps []*Opportunity) {
+	if len(opps) == 0 {
+		m.mu.Unlock()
+		return
+	}
+	m.opps.Send(opps, &m.mu)
+}
+
+// check works out spread of buying at buy and selling at sell, returning
+// opportunities for thresholds it has crossed.
+func (m *Monitor) check(p *pair, buy, sell *book.Book, bu *exchange.BookUpdate) []*Opportunity {
+	buyFee, sellFee := m.fee(buy.Exchange), m.fee(sell.Exchange)
+
+	_, ask, ok := buy.BestAsk()
+	if !ok {
+		return m.update(p, buy, sell, bu, math.Inf(-1), 0, 0, nil, nil)
+	}
+	_, bid, ok := sell.BestBid()
+	if !ok {
+		return m.update(p, buy, sell, bu, math.Inf(-1), 0, 0, nil, nil)
+	}
+	spread := net(bid, ask, buyFee, sellFee)
+
+	var asks, bids []level
+	if lowest := m.thresholds[0]; m.size > 0 || spread >= lowest { // Thresholds are sorted.
+		asks = take(buy.WalkAsks, m.size, func(price float64) bool { return net(bid, price, buyFee, sellFee) >= lowest })
+		bids = take(sell.WalkBids, m.size, func(price float64) bool { return net(price, ask, buyFee, sellFee) >= lowest })
+	}
+	if m.size > 0 {
+		var askOK, bidOK bool
+		ask, askOK = average(asks, m.size)
+		bid, bidOK = average(bids, m.size)
+		if askOK && bidOK {
+			spread = net(bid, ask, buyFee, sellFee)
+		} else {
+			spread = math.Inf(-1) // Not enough to buy or sell.
+		}
+	}
+	return m.update(p, buy, sell, bu, spread, ask, bid, asks, bids)
+}
+
+func (m *Monitor) update(p *pair, buy, sell *book.Book, bu *exchange.BookUpdate, spread, ask, bid float64, asks, bids []level) []*Opportunity {
+	buyFee, sellFee := m.fee(buy.Exchange), m.fee(sell.Exchange)
+
+	var opps []*Opportunity
+	for _, threshold := range m.thresholds {
+		r := route{buy.Exchange, sell.Exchange, threshold}
+		last := p.open[r]
+		open := spread >= threshold
+		if last == nil && !open {
+			continue
+		}
+		size := 0.0
+		if open {
+			size = executable(asks, bids, buyFee, sellFee, threshold)
+		}
+		opp := &Opportunity{
+			Pair:      p.name,
+			Timestamp: bu.Timestamp,
+			Received:  bu.Received,
+			Buy:       buy.Exchange,
+			Sell:      sell.Exchange,
+			Threshold: threshold,
+			Open:      open,
+			Ask:       ask,
+			Bid:       bid,
+			Spread:    spread,
+			Size:      size,
+			MaxSpread: spread,
+			MaxSize:   size,
+		}
+		if math.IsInf(spread, -1) {
+			opp.Spread = 0
+		}
+		if last == nil {
+			p.open[r] = opp
+			opps = append(opps, opp)
+			continue
+		}
+		opp.Duration = bu.Received.Sub(last.Received) + last.Duration
+		opp.MaxSpread = max(last.MaxSpread, opp.Spread)
+		opp.MaxSize = max(last.MaxSize, size)
+		if open {
+			p.open[r] = opp // Kept up to date, not sent.
+			continue
+		}
+		delete(p.open, r)
+		opps = append(opps, opp)
+	}
+	return opps
+}
+
+// fee returns taker fee of the exchange as a fraction.
+func (m *Monitor) fee(exch string) float64 {
+	return m.fees[strings.ToLower(exch)] / 1e4
+}
+
+type level struct {
+	price    float64
+	quantity float64
+}
+
+// take returns levels walked best first, only as many as needed for size to
+// be taken and for prices to be within, the rest of the book not looked at.
+func take(walk func(func(exchange.PriceLevelUpdate, float64) bool), size float64, within func(price float64) bool) []level {
+	var ll []level
+	var taken float64
+	walk(func(pl exchange.PriceLevelUpdate, price float64) bool {
+		if taken >= size && !within(price) {
+			return false
+		}
+		quantity, err := strconv.ParseFloat(pl.Quantity, 64)
+		if err != nil {
+			return true
+		}
+		ll = append(ll, level{price, quantity})
+		taken += quantity
+		return true
+	})
+	return ll
+}
+
+// net returns spread of selling at bid and buying at ask, net of fees, in bps of ask.
+func net(bid, ask, buyFee, sellFee float64) float64 {
+	return (bid*(1-sellFee) - ask*(1+buyFee)) / ask * 1e4
+}
+
+// average returns average price of size taken from levels, ok being false if
+// there's not enough.
+func average(levels []level, size float64) (price float64, ok bool) {
+	var cost, taken float64
+	for _, l := range levels {
+		q := min(l.quantity, size-taken)
+		cost += q * l.price
+		if taken += q; taken >= size {
+			return cost / taken, true
+		}
+	}
+	return 0, false
+}
+
+// executable returns quantity that can be bought from asks and sold to bids at
+// spreads at threshold or above, levels being best first.
+func executable(asks, bids []level, buyFee, sellFee, threshold float64) float64 {
+	var size float64
+	i, j := 0, 0
+	var askTaken, bidTaken float64
+	for i < len(asks) && j < len(bids) {
+		if net(bids[j].price, asks[i].price, buyFee, sellFee) < threshold {
+			break
+		}
+		q := min(asks[i].quantity-askTaken, bids[j].quantity-bidTaken)
+		size += q
+		if askTaken += q; askTaken >= asks[i].quantity {
+			i, askTaken = i+1, 0
+		}
+		if bidTaken += q; bidTaken >= bids[j].quantity {
+			j, bidTaken = j+1, 0
+		}
+	}
+	return size
+}
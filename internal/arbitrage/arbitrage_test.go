@@ -0,0 +1,159 @@
+package arbitrage
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestNet(t *testing.T) {
+	tests := []struct {
+		name            string
+		bid, ask        float64
+		buyFee, sellFee float64
+		want            float64
+	}{
+		{"no fees", 101, 100, 0, 0, 100},
+		{"crossed", 99, 100, 0, 0, -100},
+		{"fees", 101, 100, 0.001, 0.001, 79.9},
+		{"fees eating spread", 100.2, 100, 0.001, 0.001, -0.02},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := net(tt.bid, tt.ask, tt.buyFee, tt.sellFee); !near(got, tt.want) {
+				t.Errorf("net = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAverage(t *testing.T) {
+	levels := []level{{100, 1}, {101, 1}, {102, 2}}
+	tests := []struct {
+		name   string
+		size   float64
+		want   float64
+		wantOK bool
+	}{
+		{"best level", 0.5, 100, true},
+		{"whole level", 1, 100, true},
+		{"across levels", 1.5, (100 + 0.5*101) / 1.5, true},
+		{"all", 4, 101.25, true},
+		{"not enough", 4.5, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := average(levels, tt.size)
+			if ok != tt.wantOK || !near(got, tt.want) {
+				t.Errorf("average = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestExecutable(t *testing.T) {
+	asks := []level{{100, 1}, {101, 2}}
+	bids := []level{{102, 1.5}, {100.5, 1}}
+	tests := []struct {
+		name      string
+		fee       float64
+		threshold float64
+		want      float64
+	}{
+		{"all crossed", 0, -100, 2.5},
+		{"best only", 0, 199.9, 1},
+		{"above best", 0, 200.1, 0},
+		{"partly taken levels", 0, 50, 1.5},
+		{"fees", 0.001, 150, 1},
+		{"fees best only", 0.001, 179.7, 1},
+		{"fees above best", 0.001, 179.9, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := executable(asks, bids, tt.fee, tt.fee, tt.threshold); !near(got, tt.want) {
+				t.Errorf("executable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Opportunities open as spreads go to thresholds, kept up to date while open,
+// and are sent again when closing, with how long they lasted.
+func TestMonitor(t *testing.T) {
+	at := func(s int) timestamp.T { return timestamp.T(time.Duration(s) * time.Second) }
+	update := func(exch string, received int, kind exchange.UpdateKind, bids, asks []exchange.PriceLevelUpdate) *exchange.BookUpdate {
+		return &exchange.BookUpdate{
+			Exchange: exch, Symbol: "BTCUSD", Timestamp: at(received), Received: at(received),
+			Bids: bids, Asks: asks, Kind: kind,
+		}
+	}
+	pl := func(price, quantity string) []exchange.PriceLevelUpdate {
+		return []exchange.PriceLevelUpdate{{Price: price, Quantity: quantity}}
+	}
+
+	m := NewMonitor([]float64{150, 50}, nil, 0)
+	ina, inb := make(chan *exchange.BookUpdate), make(chan *exchange.BookUpdate)
+	outa, outb := m.Tap(ina, "BTC-USD"), m.Tap(inb, "BTC-USD")
+	apply := func(bu *exchange.BookUpdate) {
+		in, out := ina, outa
+		if bu.Exchange == "B" {
+			in, out = inb, outb
+		}
+		in <- bu
+		<-out
+	}
+
+	apply(update("A", 1, exchange.Snapshot, pl("99", "1"), pl("100", "1")))
+	apply(update("B", 2, exchange.Snapshot, pl("99", "1"), pl("100", "1")))
+	apply(update("B", 3, exchange.Delta, pl("101", "0.5"), nil)) // Opens at 50.
+	apply(update("B", 5, exchange.Delta, pl("102", "2"), nil))   // Opens at 150, 50 kept open.
+	apply(update("B", 6, exchange.Delta, pl("102", "0"), nil))   // Closes at 150.
+	apply(update("B", 8, exchange.Delta, pl("101", "0"), nil))   // Closes at 50.
+	apply(update("A", 9, exchange.Delta, nil, pl("98", "1")))    // Opens at 50 again.
+	close(ina)
+	close(inb)
+	for range outa {
+	}
+	for range outb {
+	}
+	m.Close()
+
+	type want struct {
+		buy, sell string
+		threshold float64
+		open      bool
+		spread    float64
+		size      float64
+		duration  time.Duration
+		maxSpread float64
+	}
+	wants := []want{
+		{"A", "B", 50, true, 100, 0.5, 0, 100},
+		{"A", "B", 150, true, 200, 1, 0, 200},
+		{"A", "B", 150, false, 100, 0, time.Second, 200},
+		{"A", "B", 50, false, -100, 0, 5 * time.Second, 200},
+		{"A", "B", 50, true, 1e4 / 98, 1, 0, 1e4 / 98},
+		{"A", "B", 50, false, 1e4 / 98, 1, 0, 1e4 / 98}, // Closed with the books.
+	}
+	var got []*Opportunity
+	for opps := range m.Opportunities() {
+		got = append(got, opps...)
+	}
+	if len(got) != len(wants) {
+		t.Fatalf("opportunities = %d, want %d", len(got), len(wants))
+	}
+	for i, w := range wants {
+		o := got[i]
+		if o.Buy != w.buy || o.Sell != w.sell || o.Threshold != w.threshold || o.Open != w.open ||
+			!near(o.Spread, w.spread) || !near(o.Size, w.size) || o.Duration != w.duration || !near(o.MaxSpread, w.maxSpread) {
+			t.Errorf("opportunity %d = %+v, want %+v", i, *o, w)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package book
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Book is the state of an exchange's book for a symbol, as built up from the
+// book updates applied to it. Levels are kept by price, best first on either
+// side, levels with zero quantity being removed.
+type Book struct {
+	Exchange string
+	Symbol   string
+
+	Timestamp timestamp.T // Of the last update applied.
+	Received  timestamp.T
+
+	bids side
+	asks side
+}
+
+type level struct {
+	price float64
+	exchange.PriceLevelUpdate
+}
+
+type side struct {
+	levels []level // Best first.
+	better func(p, q float64) bool
+}
+
+func New(exch, symbol string) *Book {
+	return &Book{
+		Exchange: exch,
+		Symbol:   symbol,
+		bids:     side{better: func(p, q float64) bool { return p > q }},
+		asks:     side{better: func(p, q float64) bool { return p < q }},
+	}
+}
+
+// Apply updates the book with levels of bu, clearing it first if bu is a
+// snapshot or reset. Levels with malformed prices or quantities, or negative
+// quantities, are ignored.
+func (b *Book) Apply(bu *exchange.BookUpdate) {
+	b.Timestamp, b.Received = bu.Timestamp, bu.Received
+	if bu.Kind != exchange.Delta {
+		b.Clear()
+	}
+	b.bids.apply(bu.Bids)
+	b.asks.apply(bu.Asks)
+}
+
+func (s *side) apply(updates []exchange.PriceLevelUpdate) {
+	if len(s.levels) == 0 && len(updates) > 1 {
+		s.fill(updates)
+		return
+	}
+	for _, u := range updates {
+		price, quantity, ok := parse(u)
+		if !ok {
+			continue
+		}
+		i, found := s.find(price)
+		switch {
+		case quantity == 0:
+			if found {
+				s.levels = slices.Delete(s.levels, i, i+1)
+			}
+		case found:
+			s.levels[i] = level{price, u}
+		default:
+			s.levels = slices.Insert(s.levels, i, level{price, u})
+		}
+	}
+}
+
+// fill fills the empty side with levels of updates, sorting them at once
+// rather than inserting one by one, later updates of a price winning.
+func (s *side) fill(updates []exchange.PriceLevelUpdate) {
+	type entry struct {
+		level
+		removed bool
+	}
+	entries := make([]entry, 0, len(updates))
+	for _, u := range updates {
+		if price, quantity, ok := parse(u); ok {
+			entries = append(entries, entry{level{price, u}, quantity == 0})
+		}
+	}
+	slices.SortStableFunc(entries, func(e, f entry) int {
+		switch {
+		case s.better(e.price, f.price):
+			return -1
+		case s.better(f.price, e.price):
+			return 1
+		}
+		return 0
+	})
+	for i, e := range entries {
+		if i+1 < len(entries) && entries[i+1].price == e.price {
+			continue // Updated later.
+		}
+		if !e.removed {
+			s.levels = append(s.levels, e.level)
+		}
+	}
+}
+
+// find returns index of the level at price, or where it would be inserted.
+func (s *side) find(price float64) (int, bool) {
+	i := sort.Search(len(s.levels), func(i int) bool { return !s.better(s.levels[i].price, price) })
+	return i, i < len(s.levels) && s.levels[i].price == price
+}
+
+func parse(u exchange.PriceLevelUpdate) (price, quantity float64, ok bool) {
+	price, err := strconv.ParseFloat(u.Price, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	quantity, err = strconv.ParseFloat(u.Quantity, 64)
+	if err != nil || quantity < 0 {
+		return 0, 0, false
+	}
+	return price, quantity, true
+}
+
+// Clear removes all levels.
+func (b *Book) Clear() {
+	b.bids.levels = b.bids.levels[:0]
+	b.asks.levels = b.asks.levels[:0]
+}
+
+func (b *Book) Empty() bool {
+	return len(b.bids.levels) == 0 && len(b.asks.levels) == 0
+}
+
+// Best returns best bid and ask prices, ok being false if either side is empty.
+func (b *Book) Best() (bid, ask float64, ok bool) {
+	_, bid, bok := b.BestBid()
+	_, ask, aok := b.BestAsk()
+	return bid, ask, bok && aok
+}
+
+// BestBid returns best bid level and its price, ok being false if there are no bids.
+func (b *Book) BestBid() (pl exchange.PriceLevelUpdate, price float64, ok bool) {
+	return b.bids.best()
+}
+
+// BestAsk returns best ask level and its price, ok being false if there are no asks.
+func (b *Book) BestAsk() (pl exchange.PriceLevelUpdate, price float64, ok bool) {
+	return b.asks.best()
+}
+
+func (s *side) best() (exchange.PriceLevelUpdate, float64, bool) {
+	if len(s.levels) == 0 {
+		return exchange.PriceLevelUpdate{}, 0, false
+	}
+	return s.levels[0].PriceLevelUpdate, s.levels[0].price, true
+}
+
+// Levels calls f for every level, bids and then asks, best first.
+func (b *Book) Levels(f func(side exchange.Side, pl exchange.PriceLevelUpdate, price float64)) {
+	for _, l := range b.bids.levels {
+		f(exchange.Bid, l.PriceLevelUpdate, l.price)
+	}
+	for _, l := range b.asks.levels {
+		f(exchange.Ask, l.PriceLevelUpdate, l.price)
+	}
+}
+
+// WalkBids calls f for bid levels, best first, till f returns false.
+func (b *Book) WalkBids(f func(pl exchange.PriceLevelUpdate, price float64) bool) {
+	b.bids.walk(f)
+}
+
+// WalkAsks calls f for ask levels, best first, till f returns false.
+func (b *Book) WalkAsks(f func(pl exchange.PriceLevelUpdate, price float64) bool) {
+	b.asks.walk(f)
+}
+
+func (s *side) walk(f func(pl exchange.PriceLevelUpdate, price float64) bool) {
+	for _, l := range s.levels {
+		if !f(l.PriceLevelUpdate, l.price) {
+			return
+		}
+	}
+}
+
+// Bids returns up to depth bid levels, best first, all if depth is 0.
+func (b *Book) Bids(depth int) []exchange.PriceLevelUpdate {
+	return b.bids.top(depth)
+}
+
+// Asks returns up to depth ask levels, best first, all if depth is 0.
+func (b *Book) Asks(depth int) []exchange.PriceLevelUpdate {
+	return b.asks.top(depth)
+}
+
+// Snapshot returns up to depth levels of the book on each side, all if depth
+// is 0, as a snapshot update, levels best first.
+func (b *Book) Snapshot(depth int) *exchange.BookUpdate {
+	return &exchange.BookUpdate{
+		Exchange:  b.Exchange,
+		Symbol:    b.Symbol,
+		Timestamp: b.Timestamp,
+		Received:  b.Received,
+		Bids:      b.Bids(depth),
+		Asks:      b.Asks(depth),
+		Kind:      exchange.Snapshot,
+	}
+}
+
+func (s *side) top(depth int) []exchange.PriceLevelUpdate {
+	ll := s.levels
+	if depth > 0 && depth < len(ll) {
+		ll = ll[:depth]
+	}
+	pls := make([]exchange.PriceLevelUpdate, len(ll))
+	for i, l := range ll {
+		pls[i] = l.PriceLevelUpdate
+	}
+	return pls
+}
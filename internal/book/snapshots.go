@@ -0,0 +1,147 @@
+package book
+
+import (
+	"sync"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/common/outbox"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Snapshotter keeps books from updates passing through it, and takes snapshots
+// of them every interval, on wall-clock interval boundaries.
+type Snapshotter struct {
+	interval time.Duration
+	depth    int
+
+	mu        sync.Mutex
+	books     []*Book
+	snapshots *outbox.Outbox[[]*exchange.BookUpdate]
+	done      chan struct{}
+	closed    bool
+}
+
+// NewSnapshotter makes a snapshotter taking up to depth levels of books on
+// each side, all if depth is 0.
+func NewSnapshotter(interval time.Duration, depth int) *Snapshotter {
+	s := &Snapshotter{
+		interval:  interval,
+		depth:     depth,
+		snapshots: outbox.New[[]*exchange.BookUpdate](1),
+		done:      make(chan struct{}),
+	}
+	go s.clock()
+	return s
+}
+
+// Tap keeps books from updates coming from in, passing them through to the
+// returned channel. Books are dropped once in gets closed.
+func (s *Snapshotter) Tap(in <-chan *exchange.BookUpdate) <-chan *exchange.BookUpdate {
+	out := make(chan *exchange.BookUpdate, 1)
+	go func() {
+		defer close(out)
+		var books []*Book
+		for bu := range in {
+			s.apply(&books, bu)
+			out <- bu
+		}
+		s.drop(books)
+	}()
+	return out
+}
+
+// Snapshots returns the channel snapshots are sent to, all books' taken at
+// the same time in one batch. Snapshots have the time they're taken at for
+// timestamp.
+func (s *Snapshotter) Snapshots() <-chan []*exchange.BookUpdate {
+	return s.snapshots.C()
+}
+
+// Close stops taking snapshots, closing the snapshots channel.
+func (s *Snapshotter) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.done)
+	s.mu.Unlock()
+	s.snapshots.Close()
+}
+
+func (s *Snapshotter) apply(books *[]*Book, bu *exchange.BookUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range *books {
+		if b.Exchange == bu.Exchange && b.Symbol == bu.Symbol {
+			b.Apply(bu)
+			return
+		}
+	}
+	b := New(bu.Exchange, bu.Symbol)
+	b.Apply(bu)
+	*books = append(*books, b)
+	s.books = append(s.books, b)
+}
+
+func (s *Snapshotter) drop(books []*Book) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.books[:0]
+	for _, b := range s.books {
+		dropped := false
+		for _, d := range books {
+			if b == d {
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			kept = append(kept, b)
+		}
+	}
+	clear(s.books[len(kept):])
+	s.books = kept
+}
+
+func (s *Snapshotter) clock() {
+	for {
+		now := time.Now()
+		boundary := now.Truncate(s.interval).Add(s.interval)
+		timer := time.NewTimer(boundary.Sub(now))
+		select {
+		case <-timer.C:
+		case <-s.done:
+			timer.Stop()
+			return
+		}
+		s.snapshot(timestamp.Stamp(boundary))
+	}
+}
+
+func (s *Snapshotter) snapshot(ts timestamp.T) {
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	var snapshots []*exchange.BookUpdate
+	for _, b := range s.books {
+		if b.Empty() {
+			continue
+		}
+		snapshot := b.Snapshot(s.depth)
+		snapshot.Timestamp = ts
+		snapshots = append(snapshots, snapshot)
+	}
+	if len(snapshots) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	s.snapshots.Send(snapshots, &s.mu)
+}
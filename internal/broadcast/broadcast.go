@@ -0,0 +1,296 @@
+package broadcast
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/book"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Broadcaster hands book updates and trades it's fed out to any number of
+// subscribers, each of them getting the updates it wants in its own buffer.
+// Books are kept, so that subscribers joining late get snapshots of them
+// first. Subscribers never hold up the others, those not keeping up having
+// updates dropped or getting disconnected, as their overflow policy says.
+type Broadcaster struct {
+	mu     sync.Mutex
+	books  map[venue]*book.Book
+	subs   map[*Subscriber]struct{}
+	closed bool
+}
+
+type venue struct {
+	exchange string
+	symbol   string
+}
+
+// Overflow tells what's done with an update for a subscriber with its buffer full.
+type Overflow int
+
+const (
+	Drop       Overflow = iota // Drop it, the book being sent whole in place of the next update once there's room.
+	Disconnect                 // Unsubscribe the subscriber, closing its channel.
+)
+
+// Filter tells what a subscriber gets, updates of all exchanges or symbols if
+// none are listed.
+type Filter struct {
+	Exchanges []string
+	Symbols   []string
+	Books     bool
+	Trades    bool
+}
+
+// Update is either a book update or trades.
+type Update struct {
+	Book   *exchange.BookUpdate
+	Trades []*exchange.Trade
+}
+
+type Subscriber struct {
+	filter   Filter
+	overflow Overflow
+	b        *Broadcaster
+
+	mu           sync.Mutex
+	ch           chan Update
+	stale        map[venue]bool // Books with updates dropped, to be sent whole next.
+	closed       bool
+	disconnected bool
+}
+
+func New() *Broadcaster {
+	return &Broadcaster{
+		books: make(map[venue]*book.Book),
+		subs:  make(map[*Subscriber]struct{}),
+	}
+}
+
+// Pump feeds book updates and trades of listener, which must have been
+// started, to the broadcaster, closing it once the listener stops. Listener's
+// Book and Trades channels must not be read from otherwise.
+func (b *Broadcaster) Pump(listener exchange.Listener) {
+	var wg sync.WaitGroup
+	if in := listener.Book(); in != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bu := range in {
+				b.OnBook(bu)
+			}
+		}()
+	}
+	if in := listener.Trades(); in != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for trades := range in {
+				b.OnTrade(trades)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		b.Close()
+	}()
+}
+
+// Subscribe subscribes to updates filter lets through, buffering up to buffer
+// of them, books to be sent first not counting. The subscriber's channel gets
+// closed once the broadcaster is or Unsubscribe is called.
+func (b *Broadcaster) Subscribe(filter Filter, buffer int, overflow Overflow) *Subscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscriber{
+		filter:   filter,
+		overflow: overflow,
+		b:        b,
+		ch:       make(chan Update, max(buffer, 1)+len(b.books)),
+		stale:    make(map[venue]bool),
+	}
+	if b.closed {
+		sub.closed = true
+		close(sub.ch)
+		return sub
+	}
+	for v, bk := range b.books {
+		if filter.wants(v, false) && !bk.Empty() {
+			sub.ch <- Update{Book: bk.Snapshot(0)}
+		}
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+func (b *Broadcaster) OnBook(bu *exchange.BookUpdate) {
+	v := venue{bu.Exchange, bu.Symbol}
+
+	b.mu.Lock()
+	bk := b.books[v]
+	if bk == nil {
+		bk = book.New(bu.Exchange, bu.Symbol)
+		b.books[v] = bk
+	}
+	bk.Apply(bu)
+	var snapshot *exchange.BookUpdate
+	subs := b.subscribers(v, false)
+	for _, sub := range subs {
+		if snapshot == nil && sub.isStale(v) {
+			snapshot = bk.Snapshot(0)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.sendBook(v, bu, snapshot)
+	}
+}
+
+func (b *Broadcaster) OnTrade(trades []*exchange.Trade) {
+	if len(trades) == 0 {
+		return
+	}
+	v := venue{trades[0].Exchange, trades[0].Symbol}
+
+	b.mu.Lock()
+	subs := b.subscribers(v, true)
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.send(v, Update{Trades: trades})
+	}
+}
+
+// Close unsubscribes all subscribers, closing their channels.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		sub.close()
+		delete(b.subs, sub)
+	}
+}
+
+// subscribers returns subscribers wanting updates of the venue, dropping those
+// disconnected meanwhile. Called with mu held.
+func (b *Broadcaster) subscribers(v venue, trades bool) []*Subscriber {
+	var subs []*Subscriber
+	for sub := range b.subs {
+		if sub.isClosed() {
+			delete(b.subs, sub)
+			continue
+		}
+		if sub.filter.wants(v, trades) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// Updates returns the channel updates are sent to.
+func (s *Subscriber) Updates() <-chan Update {
+	return s.ch
+}
+
+// Disconnected tells if the subscriber got disconnected for not keeping up.
+func (s *Subscriber) Disconnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.disconnected
+}
+
+// Unsubscribe stops updates, closing the channel.
+func (s *Subscriber) Unsubscribe() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	delete(s.b.subs, s)
+	s.close()
+}
+
+func (s *Subscriber) sendBook(v venue, bu, snapshot *exchange.BookUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stale[v] {
+		if snapshot == nil {
+			return // Stale since looked at, to be sent whole next time.
+		}
+		bu = snapshot
+	}
+	if s.sendLocked(Update{Book: bu}) {
+		delete(s.stale, v)
+	} else if s.overflow == Drop {
+		s.stale[v] = true
+	}
+}
+
+func (s *Subscriber) send(v venue, u Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sendLocked(u)
+}
+
+// sendLocked sends u if there's room, disconnecting the subscriber if not and
+// its overflow policy says so. Called with mu held.
+func (s *Subscriber) sendLocked(u Update) bool {
+	if s.closed {
+		return false
+	}
+	select {
+	case s.ch <- u:
+		return true
+	default:
+	}
+	if s.overflow == Disconnect {
+		s.disconnected = true
+		s.closed = true
+		close(s.ch)
+	}
+	return false
+}
+
+func (s *Subscriber) isStale(v venue) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stale[v]
+}
+
+func (s *Subscriber) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+func (f *Filter) wants(v venue, trades bool) bool {
+	if trades && !f.Trades || !trades && !f.Books {
+		return false
+	}
+	return matches(f.Exchanges, v.exchange) && matches(f.Symbols, v.symbol)
+}
+
+func matches(names []string, name string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+package candles
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/common/outbox"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+type Candle struct {
+	Exchange string
+	Symbol   string
+
+	Interval time.Duration
+	Start    timestamp.T
+
+	Open  string
+	High  string
+	Low   string
+	Close string
+
+	Volume     string
+	BuyVolume  string
+	SellVolume string
+	Trades     int
+}
+
+// Builder aggregates trades into OHLCV candles for every exchange and symbol
+// it sees, for each of the given intervals. Candles are closed on wall-clock
+// interval boundaries, no matter whether trades keep coming or not. Intervals
+// that have seen no trades produce flat candles at the previous close. Trades
+// late for the last candle closed have it sent again, corrected; trades late
+// for earlier candles are dropped.
+type Builder struct {
+	intervals []time.Duration
+
+	mu   sync.Mutex
+	bars map[barKey]*bar
+
+	candles *outbox.Outbox[[]*Candle]
+	inputs  sync.WaitGroup
+	done    chan struct{}
+}
+
+type barKey struct {
+	exchange string
+	symbol   string
+	interval time.Duration
+}
+
+type bar struct {
+	start timestamp.T
+
+	open, high, low, close string
+	hi, lo                 float64
+	opened, closed         timestamp.T // Times of open and close trades.
+
+	volume, buy, sell float64
+	decimals          int
+	trades            int
+
+	last *bar // Last one closed, for late trades.
+}
+
+func NewBuilder(intervals ...time.Duration) *Builder {
+	b := &Builder{
+		intervals: intervals,
+		bars:      make(map[barKey]*bar),
+		candles:   outbox.New[[]*Candle](16),
+		done:      make(chan struct{}),
+	}
+	for _, interval := range intervals {
+		go b.clock(interval)
+	}
+	return b
+}
+
+// Tap aggregates trades coming from in, passing them through to the returned channel.
+func (b *Builder) Tap(in <-chan []*exchange.Trade) <-chan []*exchange.Trade {
+	out := make(chan []*exchange.Trade, 1)
+	b.inputs.Add(1)
+	go func() {
+		defer b.inputs.Done()
+		defer close(out)
+		for trades := range in {
+			b.add(trades)
+			out <- trades
+		}
+	}()
+	return out
+}
+
+// Consume aggregates trades coming from in, dropping them afterwards.
+func (b *Builder) Consume(in <-chan []*exchange.Trade) {
+	b.inputs.Add(1)
+	go func() {
+		defer b.inputs.Done()
+		for trades := range in {
+			b.add(trades)
+		}
+	}()
+}
+
+// Candles returns the channel candles are sent to. It gets closed once all
+// inputs are, so all of them must have been added by the time Candles is called.
+func (b *Builder) Candles() <-chan []*Candle {
+	go func() {
+		b.inputs.Wait()
+		b.mu.Lock()
+		close(b.done)
+		b.mu.Unlock()
+		b.candles.Close()
+	}()
+	return b.candles.C()
+}
+
+func (b *Builder) add(trades []*exchange.Trade) {
+	b.mu.Lock()
+
+	var closed []*Candle
+	var corrected []*bar
+	var correctedKeys []barKey
+	for _, trade := range trades {
+		price, err := strconv.ParseFloat(trade.Price, 64)
+		if err != nil {
+			continue
+		}
+		quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+		if err != nil {
+			continue
+		}
+		if trade.Amended {
+			continue // Counted already.
+		}
+		occurred := trade.Occurred
+		if occurred == 0 {
+			occurred = trade.Timestamp
+		}
+		for _, interval := range b.intervals {
+			key := barKey{trade.Exchange, trade.Symbol, interval}
+			start := occurred.Truncate(interval)
+			br := b.bars[key]
+			if br == nil {
+				br = &bar{start: start}
+				b.bars[key] = br
+			} else if start > br.start {
+				// Trades from the next interval may get here before the clock does.
+				closed = b.close(closed, key, br, start)
+			} else if start < br.start {
+				last := br.last
+				if last == nil || start != last.start {
+					continue // Too late to be counted.
+				}
+				if !slices.Contains(corrected, last) {
+					corrected, correctedKeys = append(corrected, last), append(correctedKeys, key)
+				}
+				br = last
+			}
+			br.add(trade, occurred, price, quantity)
+		}
+	}
+	for i, br := range corrected {
+		closed = append(closed, br.candle(correctedKeys[i]))
+	}
+	b.send(closed)
+}
+
+func (br *bar) add(trade *exchange.Trade, occurred timestamp.T, price, quantity float64) {
+	if br.trades == 0 {
+		br.open, br.high, br.low = trade.Price, trade.Price, trade.Price
+		br.hi, br.lo = price, price
+		br.opened = occurred
+	}
+	if price > br.hi {
+		br.high, br.hi = trade.Price, price
+	}
+	if price < br.lo {
+		br.low, br.lo = trade.Price, price
+	}
+	if occurred < br.opened {
+		br.open, br.opened = trade.Price, occurred
+	}
+	if occurred >= br.closed {
+		br.close, br.closed = trade.Price, occurred
+	}
+	br.volume += quantity
+	if trade.Taker == exchange.Buy {
+		br.buy += quantity
+	} else {
+		br.sell += quantity
+	}
+	br.decimals = max(br.decimals, decimals(trade.Quantity))
+	br.trades++
+}
+
+func (b *Builder) clock(interval time.Duration) {
+	for {
+		now := time.Now()
+		boundary := now.Truncate(interval).Add(interval)
+		timer := time.NewTimer(boundary.Sub(now))
+		select {
+		case <-timer.C:
+		case <-b.done:
+			timer.Stop()
+			return
+		}
+		b.tick(interval, timestamp.Stamp(boundary))
+	}
+}
+
+func (b *Builder) tick(interval time.Duration, boundary timestamp.T) {
+	b.mu.Lock()
+
+	select {
+	case <-b.done:
+		b.mu.Unlock()
+		return
+	default:
+	}
+	var closed []*Candle
+	for key, br := range b.bars {
+		if key.interval != interval || br.start >= boundary {
+			continue
+		}
+		closed = b.close(closed, key, br, boundary)
+	}
+	b.send(closed)
+}
+
+// send sends closed candles, if any, unlocking b.mu.
+func (b *Builder) send(closed []*Candle) {
+	if len(closed) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	b.candles.Send(closed, &b.mu)
+}
+
+// close appends the candle for the given bar and resets the bar to start anew.
+func (b *Builder) close(closed []*Candle, key barKey, br *bar, start timestamp.T) []*Candle {
+	if c := br.candle(key); c != nil {
+		closed = append(closed, c)
+	}
+	last := *br
+	last.last = nil
+	*br = bar{start: start, close: br.close, last: &last}
+	return closed
+}
+
+// candle returns the candle for the bar, nil if there have been no trades yet.
+func (br *bar) candle(key barKey) *Candle {
+	if br.trades > 0 {
+		return &Candle{
+			Exchange:   key.exchange,
+			Symbol:     key.symbol,
+			Interval:   key.interval,
+			Start:      br.start,
+			Open:       br.open,
+			High:       br.high,
+			Low:        br.low,
+			Close:      br.close,
+			Volume:     formatFloat(br.volume, br.decimals),
+			BuyVolume:  formatFloat(br.buy, br.decimals),
+			SellVolume: formatFloat(br.sell, br.decimals),
+			Trades:     br.trades,
+		}
+	}
+	if br.close != "" {
+		return &Candle{
+			Exchange:   key.exchange,
+			Symbol:     key.symbol,
+			Interval:   key.interval,
+			Start:      br.start,
+			Open:       br.close,
+			High:       br.close,
+			Low:        br.close,
+			Close:      br.close,
+			Volume:     "0",
+			BuyVolume:  "0",
+			SellVolume: "0",
+		}
+	}
+	return nil
+}
+
+// decimals returns the number of decimal places in s.
+func decimals(s string) int {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+// formatFloat formats f rounded to the given decimal places, those of the
+// quantities summed up, for float64 error not to get printed.
+func formatFloat(f float64, decimals int) string {
+	return strconv.FormatFloat(f, 'f', decimals, 64)
+}
@@ -0,0 +1,85 @@
+package candles
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/common/outbox"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Trades late for the last candle closed have it sent again, corrected, those
+// later still being dropped. Steps either add trades or tick the clock.
+func TestLateTrades(t *testing.T) {
+	at := func(s int) timestamp.T { return timestamp.T(time.Duration(s) * time.Second) }
+	trade := func(s int, price, quantity string, taker exchange.Side) *exchange.Trade {
+		return &exchange.Trade{Exchange: "X", Symbol: "BTCUSD", Occurred: at(s), Price: price, Quantity: quantity, Taker: taker}
+	}
+	candle := func(s int, open, high, low, close, volume, buy, sell string, trades int) *Candle {
+		return &Candle{
+			Exchange: "X", Symbol: "BTCUSD", Interval: time.Minute, Start: at(s),
+			Open: open, High: high, Low: low, Close: close,
+			Volume: volume, BuyVolume: buy, SellVolume: sell, Trades: trades,
+		}
+	}
+
+	steps := []struct {
+		name   string
+		trades []*exchange.Trade
+		tick   int // Boundary, in seconds, if no trades.
+		want   []*Candle
+	}{
+		{"trades", []*exchange.Trade{trade(10, "100", "1", exchange.Buy), trade(30, "102", "0.5", exchange.Sell)}, 0,
+			nil},
+		{"closed", nil, 60,
+			[]*Candle{candle(0, "100", "102", "100", "102", "1.5", "1.0", "0.5", 2)}},
+		{"late", []*exchange.Trade{trade(50, "99", "0.25", exchange.Buy)}, 0,
+			[]*Candle{candle(0, "100", "102", "99", "99", "1.75", "1.25", "0.50", 3)}},
+		{"next", []*exchange.Trade{trade(70, "101", "1", exchange.Buy)}, 0,
+			nil},
+		{"next closed", nil, 120,
+			[]*Candle{candle(60, "101", "101", "101", "101", "1", "1", "0", 1)}},
+		{"too late", []*exchange.Trade{trade(40, "98", "1", exchange.Buy)}, 0,
+			nil},
+		{"late among current", []*exchange.Trade{trade(130, "103", "2", exchange.Sell), trade(110, "100", "1", exchange.Buy)}, 0,
+			[]*Candle{candle(60, "101", "101", "100", "100", "2", "2", "0", 2)}},
+		{"current closed", nil, 180,
+			[]*Candle{candle(120, "103", "103", "103", "103", "2", "0", "2", 1)}},
+		{"ahead of clock", []*exchange.Trade{trade(245, "104", "1", exchange.Buy)}, 0,
+			[]*Candle{candle(180, "103", "103", "103", "103", "0", "0", "0", 0)}},
+		{"clock behind", nil, 240,
+			nil},
+		{"late for flat", []*exchange.Trade{trade(200, "102", "1", exchange.Sell)}, 0,
+			[]*Candle{candle(180, "102", "102", "102", "102", "1", "0", "1", 1)}},
+	}
+
+	// No clocks, ticks being made by the test.
+	b := &Builder{
+		intervals: []time.Duration{time.Minute},
+		bars:      make(map[barKey]*bar),
+		candles:   outbox.New[[]*Candle](16),
+		done:      make(chan struct{}),
+	}
+	for _, step := range steps {
+		if step.trades != nil {
+			b.add(step.trades)
+		} else {
+			b.tick(time.Minute, at(step.tick))
+		}
+		var got []*Candle
+		for len(b.candles.C()) > 0 {
+			got = append(got, <-b.candles.C()...)
+		}
+		if len(got) != len(step.want) {
+			t.Errorf("%s: candles = %d, want %d", step.name, len(got), len(step.want))
+			continue
+		}
+		for i, c := range got {
+			if !reflect.DeepEqual(c, step.want[i]) {
+				t.Errorf("%s: candle = %+v, want %+v", step.name, c, step.want[i])
+			}
+		}
+	}
+}
@@ -3,9 +3,12 @@ package common
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/oerlikon/structs"
 	"github.com/rs/zerolog"
+
+	"github.com/oerlikon/sounding/internal/exchange"
 )
 
 type Option func(options interface{}) error
@@ -13,41 +16,53 @@ type Option func(options interface{}) error
 var ErrBadOption = errors.New("bad option")
 
 func OptionStdout(stdout Printlnfer) Option {
-	return func(options interface{}) error {
-		s := structs.New(options)
-		field := s.Field("Stdout")
-		if field == nil {
-			return ErrBadOption
-		}
-		if err := field.Set(stdout); err != nil {
-			return fmt.Errorf("%w: %s", ErrBadOption, err)
-		}
-		return nil
-	}
+	return option("Stdout", stdout)
 }
 
 func OptionStderr(stderr Printlnfer) Option {
-	return func(options interface{}) error {
-		s := structs.New(options)
-		field := s.Field("Stderr")
-		if field == nil {
-			return ErrBadOption
-		}
-		if err := field.Set(stderr); err != nil {
-			return fmt.Errorf("%w: %s", ErrBadOption, err)
-		}
-		return nil
-	}
+	return option("Stderr", stderr)
 }
 
 func OptionLogger(logger zerolog.Logger) Option {
+	return option("Logger", logger)
+}
+
+func OptionBuffer(buffer int) Option {
+	return option("Buffer", buffer)
+}
+
+func OptionOverflow(overflow exchange.Overflow) Option {
+	return option("Overflow", overflow)
+}
+
+func OptionDepth(depth int) Option {
+	return option("Depth", depth)
+}
+
+func OptionSpeed(speed time.Duration) Option {
+	return option("Speed", speed)
+}
+
+func OptionFrequency(frequency string) Option {
+	return option("Frequency", frequency)
+}
+
+func OptionPrecision(precision string) Option {
+	return option("Precision", precision)
+}
+
+func OptionFinalTrades(final bool) Option {
+	return option("FinalTrades", final)
+}
+
+func option(name string, value interface{}) Option {
 	return func(options interface{}) error {
 		s := structs.New(options)
-		field := s.Field("Logger")
+		field := s.Field(name)
 		if field == nil {
 			return ErrBadOption
 		}
-		if err := field.Set(logger); err != nil {
+		if err := field.Set(value); err != nil {
 			return fmt.Errorf("%w: %s", ErrBadOption, err)
 		}
 		return nil
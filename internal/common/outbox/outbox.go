@@ -0,0 +1,43 @@
+package outbox
+
+import "sync"
+
+// Outbox is a channel that values made under some other lock are sent to
+// in the order they were made, without that lock being held while a send
+// waits for the receiver. Values sent once the outbox is closed are dropped.
+type Outbox[T any] struct {
+	mu     sync.Mutex
+	ch     chan T
+	closed bool
+}
+
+func New[T any](size int) *Outbox[T] {
+	return &Outbox[T]{ch: make(chan T, size)}
+}
+
+// C returns the channel values are sent to.
+func (o *Outbox[T]) C() <-chan T {
+	return o.ch
+}
+
+// Send sends v, with locked unlocked as soon as v's turn to be sent has come.
+// Values sent from under the same lock thus keep their order.
+func (o *Outbox[T]) Send(v T, locked sync.Locker) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	locked.Unlock()
+	if o.closed {
+		return
+	}
+	o.ch <- v
+}
+
+// Close closes the channel once a send in progress, if any, is done.
+func (o *Outbox[T]) Close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		close(o.ch)
+	}
+}
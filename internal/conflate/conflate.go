@@ -0,0 +1,120 @@
+package conflate
+
+import (
+	"time"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Books passes through book updates coming from in conflated over interval:
+// levels updated during an interval go out once it's over, with the latest
+// quantity for each of them, in one update per exchange and symbol. Intervals
+// end on wall-clock boundaries, where books built from updates passed through
+// are the same as those built from updates coming in. Snapshots and resets go
+// out as soon as they come, after levels of the same book updated before them.
+func Books(in <-chan *exchange.BookUpdate, interval time.Duration) <-chan *exchange.BookUpdate {
+	out := make(chan *exchange.BookUpdate, 1)
+	go func() {
+		defer close(out)
+		var pending []*levels
+		at := make(map[venue]*levels)
+		flush := func() {
+			for _, ll := range pending {
+				if !ll.empty() {
+					out <- ll.update()
+				}
+				delete(at, venue{ll.bu.Exchange, ll.bu.Symbol})
+			}
+			pending = pending[:0]
+		}
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(interval).Add(interval).Sub(now))
+		defer timer.Stop()
+		for {
+			select {
+			case bu, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				v := venue{bu.Exchange, bu.Symbol}
+				if bu.Kind != exchange.Delta {
+					if ll := at[v]; ll != nil && !ll.empty() {
+						out <- ll.update()
+						ll.reset()
+					}
+					out <- bu
+					continue
+				}
+				ll := at[v]
+				if ll == nil {
+					ll = newLevels()
+					at[v] = ll
+					pending = append(pending, ll)
+				}
+				ll.add(bu)
+			case <-timer.C:
+				flush()
+				now := time.Now()
+				timer.Reset(now.Truncate(interval).Add(interval).Sub(now))
+			}
+		}
+	}()
+	return out
+}
+
+type venue struct {
+	exchange string
+	symbol   string
+}
+
+// levels are levels updated during an interval, in order of first update.
+type levels struct {
+	bu    exchange.BookUpdate // Last update, for exchange, symbol and times.
+	bids  []exchange.PriceLevelUpdate
+	asks  []exchange.PriceLevelUpdate
+	bidAt map[string]int
+	askAt map[string]int
+}
+
+func newLevels() *levels {
+	return &levels{
+		bidAt: make(map[string]int),
+		askAt: make(map[string]int),
+	}
+}
+
+func (ll *levels) add(bu *exchange.BookUpdate) {
+	ll.bu = *bu
+	ll.bids = merge(ll.bids, ll.bidAt, bu.Bids)
+	ll.asks = merge(ll.asks, ll.askAt, bu.Asks)
+}
+
+func merge(pls []exchange.PriceLevelUpdate, at map[string]int, updates []exchange.PriceLevelUpdate) []exchange.PriceLevelUpdate {
+	for _, u := range updates {
+		if i, ok := at[u.Price]; ok {
+			pls[i] = u
+			continue
+		}
+		at[u.Price] = len(pls)
+		pls = append(pls, u)
+	}
+	return pls
+}
+
+func (ll *levels) empty() bool {
+	return len(ll.bids) == 0 && len(ll.asks) == 0
+}
+
+// reset drops levels updated so far, which may have gone out already.
+func (ll *levels) reset() {
+	ll.bids, ll.asks = nil, nil
+	clear(ll.bidAt)
+	clear(ll.askAt)
+}
+
+func (ll *levels) update() *exchange.BookUpdate {
+	bu := ll.bu
+	bu.Bids, bu.Asks = ll.bids, ll.asks
+	return &bu
+}
@@ -0,0 +1,122 @@
+package conflate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/book"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// quantities makes levels of prices and quantities given in turn.
+func quantities(pqs ...string) []exchange.PriceLevelUpdate {
+	pls := make([]exchange.PriceLevelUpdate, 0, len(pqs)/2)
+	for i := 0; i < len(pqs); i += 2 {
+		pls = append(pls, exchange.PriceLevelUpdate{Price: pqs[i], Quantity: pqs[i+1]})
+	}
+	return pls
+}
+
+func delta(symbol string, bids, asks []exchange.PriceLevelUpdate) *exchange.BookUpdate {
+	return &exchange.BookUpdate{Exchange: "X", Symbol: symbol, Bids: bids, Asks: asks, Kind: exchange.Delta}
+}
+
+func full(symbol string, bids, asks []exchange.PriceLevelUpdate) *exchange.BookUpdate {
+	return &exchange.BookUpdate{Exchange: "X", Symbol: symbol, Bids: bids, Asks: asks, Kind: exchange.Snapshot}
+}
+
+// Books built from updates conflated are the same as those built from updates
+// coming in, whenever a book's updates go out whole: at its snapshots and
+// resets, and at the end.
+func TestBooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []*exchange.BookUpdate
+	}{
+		{"deltas", []*exchange.BookUpdate{
+			full("A", quantities("10", "1", "9", "1"), quantities("11", "1", "12", "1")),
+			delta("A", quantities("10", "2"), nil),
+			delta("A", quantities("10", "3", "8", "1"), quantities("11", "0")),
+			delta("A", quantities("8", "0"), quantities("13", "1")),
+		}},
+		{"removed and added back", []*exchange.BookUpdate{
+			full("A", quantities("10", "1"), quantities("11", "1")),
+			delta("A", quantities("10", "0"), nil),
+			delta("A", quantities("10", "5"), quantities("11", "0")),
+			delta("A", nil, quantities("11", "2")),
+		}},
+		{"snapshot midway", []*exchange.BookUpdate{
+			full("A", quantities("10", "1"), quantities("11", "1")),
+			delta("A", quantities("9", "1"), nil),
+			full("A", quantities("7", "1"), quantities("12", "1")),
+			delta("A", quantities("7", "0", "6", "1"), nil),
+		}},
+		{"reset", []*exchange.BookUpdate{
+			full("A", quantities("10", "1"), quantities("11", "1")),
+			delta("A", quantities("9", "1"), nil),
+			{Exchange: "X", Symbol: "A", Kind: exchange.Reset},
+			full("A", quantities("8", "1"), quantities("12", "1")),
+			delta("A", nil, quantities("12", "3")),
+		}},
+		{"symbols apart", []*exchange.BookUpdate{
+			full("A", quantities("10", "1"), quantities("11", "1")),
+			full("B", quantities("20", "1"), quantities("21", "1")),
+			delta("A", quantities("10", "2"), nil),
+			delta("B", quantities("20", "0", "19", "1"), nil),
+			full("A", quantities("9", "1"), quantities("11", "1")),
+			delta("B", nil, quantities("21", "4")),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := make(chan *exchange.BookUpdate, len(tt.updates))
+			want := map[string]*book.Book{}
+			var wants []*exchange.BookUpdate // Books after every snapshot or reset.
+			for _, bu := range tt.updates {
+				if want[bu.Symbol] == nil {
+					want[bu.Symbol] = book.New(bu.Exchange, bu.Symbol)
+				}
+				want[bu.Symbol].Apply(bu)
+				if bu.Kind != exchange.Delta {
+					wants = append(wants, snapshot(want[bu.Symbol]))
+				}
+				in <- bu
+			}
+			close(in)
+
+			got := map[string]*book.Book{}
+			n := 0
+			for bu := range Books(in, time.Hour) {
+				if got[bu.Symbol] == nil {
+					got[bu.Symbol] = book.New(bu.Exchange, bu.Symbol)
+				}
+				got[bu.Symbol].Apply(bu)
+				if bu.Kind != exchange.Delta {
+					if n < len(wants) && !reflect.DeepEqual(snapshot(got[bu.Symbol]), wants[n]) {
+						t.Errorf("book after snapshot %d = %+v, want %+v", n, snapshot(got[bu.Symbol]), wants[n])
+					}
+					n++
+				}
+			}
+			if n != len(wants) {
+				t.Errorf("snapshots and resets = %d, want %d", n, len(wants))
+			}
+			for symbol, b := range want {
+				if !reflect.DeepEqual(snapshot(got[symbol]), snapshot(b)) {
+					t.Errorf("book of %s = %+v, want %+v", symbol, snapshot(got[symbol]), snapshot(b))
+				}
+			}
+		})
+	}
+}
+
+// snapshot returns levels of the book, times left out.
+func snapshot(b *book.Book) *exchange.BookUpdate {
+	if b == nil {
+		return nil
+	}
+	bu := b.Snapshot(0)
+	bu.Timestamp, bu.Received = 0, 0
+	return bu
+}
@@ -0,0 +1,329 @@
+package consolidate
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/book"
+	"github.com/oerlikon/sounding/internal/common/outbox"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// BBO is best bid and offer across exchanges listened to for a pair. Where
+// several exchanges have the best price, quantity is their total.
+type BBO struct {
+	Pair string
+
+	Timestamp timestamp.T // Of the update it changed on.
+	Received  timestamp.T
+
+	BidExchanges []string
+	BidPrice     string
+	BidQuantity  string
+	AskExchanges []string
+	AskPrice     string
+	AskQuantity  string
+}
+
+// Ladder is the book of a pair consolidated across exchanges, levels best first.
+type Ladder struct {
+	Pair string   `json:"pair"`
+	Bids []*Level `json:"bids"`
+	Asks []*Level `json:"asks"`
+}
+
+// Level is the quantity at a price across exchanges, along with what each of
+// them contributes.
+type Level struct {
+	Price    string           `json:"price"`
+	Quantity string           `json:"quantity"`
+	Venues   []*VenueQuantity `json:"venues"`
+}
+
+type VenueQuantity struct {
+	Exchange string `json:"exchange"`
+	Symbol   string `json:"symbol"`
+	Quantity string `json:"quantity"`
+}
+
+// Consolidator keeps books from updates passing through it, by the pair they
+// are mapped to, and sends best bid and offer of each pair across exchanges
+// whenever it changes.
+type Consolidator struct {
+	mu    sync.Mutex
+	pairs map[string]*pair
+	bbos  *outbox.Outbox[*BBO]
+}
+
+type pair struct {
+	name  string
+	books []*book.Book
+	bbo   *BBO // Last sent.
+}
+
+func NewConsolidator() *Consolidator {
+	return &Consolidator{
+		pairs: make(map[string]*pair),
+		bbos:  outbox.New[*BBO](16),
+	}
+}
+
+// Tap keeps book of the pair from updates coming from in, passing them through
+// to the returned channel. The book is dropped once in gets closed.
+func (c *Consolidator) Tap(in <-chan *exchange.BookUpdate, name string) <-chan *exchange.BookUpdate {
+	out := make(chan *exchange.BookUpdate, 1)
+	go func() {
+		defer close(out)
+		var books []*book.Book
+		for bu := range in {
+			c.apply(name, &books, bu)
+			out <- bu
+		}
+		c.drop(name, books)
+	}()
+	return out
+}
+
+// BBOs returns the channel best bids and offers are sent to.
+func (c *Consolidator) BBOs() <-chan *BBO {
+	return c.bbos.C()
+}
+
+// BBO returns current best bid and offer of the pair, nil if there's none.
+func (c *Consolidator) BBO(name string) *BBO {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p := c.pairs[name]; p != nil {
+		return p.bbo
+	}
+	return nil
+}
+
+// Ladder returns the consolidated book of the pair, up to depth levels of it
+// on each side, all if depth is 0. Returns nil for pairs not known.
+func (c *Consolidator) Ladder(name string, depth int) *Ladder {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.pairs[name]
+	if p == nil {
+		return nil
+	}
+	bids, asks := map[float64]*Level{}, map[float64]*Level{}
+	for _, b := range p.books {
+		b.Levels(func(side exchange.Side, pl exchange.PriceLevelUpdate, price float64) {
+			levels := bids
+			if side == exchange.Ask {
+				levels = asks
+			}
+			l := levels[price]
+			if l == nil {
+				l = &Level{Price: pl.Price}
+				levels[price] = l
+			}
+			l.Venues = append(l.Venues, &VenueQuantity{b.Exchange, b.Symbol, pl.Quantity})
+		})
+	}
+	return &Ladder{
+		Pair: name,
+		Bids: ladder(bids, depth, func(p, q float64) bool { return p > q }),
+		Asks: ladder(asks, depth, func(p, q float64) bool { return p < q }),
+	}
+}
+
+// Pairs returns names of pairs known, sorted.
+func (c *Consolidator) Pairs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.pairs))
+	for name := range c.pairs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close stops sending best bids and offers, closing the channel.
+func (c *Consolidator) Close() {
+	c.bbos.Close()
+}
+
+func (c *Consolidator) apply(name string, books *[]*book.Book, bu *exchange.BookUpdate) {
+	c.mu.Lock()
+
+	p := c.pairs[name]
+	if p == nil {
+		p = &pair{name: name}
+		c.pairs[name] = p
+	}
+	var b *book.Book
+	for _, bk := range *books {
+		if bk.Exchange == bu.Exchange && bk.Symbol == bu.Symbol {
+			b = bk
+			break
+		}
+	}
+	if b == nil {
+		b = book.New(bu.Exchange, bu.Symbol)
+		*books = append(*books, b)
+		p.books = append(p.books, b)
+	}
+	b.Apply(bu)
+	c.send(c.update(p, bu.Timestamp, bu.Received))
+}
+
+func (c *Consolidator) drop(name string, books []*book.Book) {
+	c.mu.Lock()
+
+	p := c.pairs[name]
+	if p == nil {
+		c.mu.Unlock()
+		return
+	}
+	kept := p.books[:0]
+	for _, b := range p.books {
+		dropped := false
+		for _, d := range books {
+			if b == d {
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			kept = append(kept, b)
+		}
+	}
+	clear(p.books[len(kept):])
+	p.books = kept
+	if len(p.books) == 0 {
+		delete(c.pairs, name)
+		c.mu.Unlock()
+		return
+	}
+	if p.bbo == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.send(c.update(p, p.bbo.Timestamp, p.bbo.Received))
+}
+
+// update returns best bid and offer of the pair to be sent, nil if unchanged.
+func (c *Consolidator) update(p *pair, ts, received timestamp.T) *BBO {
+	bbo := p.best()
+	bbo.Timestamp, bbo.Received = ts, received
+	if p.bbo != nil && p.bbo.same(bbo) {
+		return nil
+	}
+	p.bbo = bbo
+	return bbo
+}
+
+// send sends best bid and offer, if any, unlocking mu.
+func (c *Consolidator) send(bbo *BBO) {
+	if bbo == nil {
+		c.mu.Unlock()
+		return
+	}
+	c.bbos.Send(bbo, &c.mu)
+}
+
+// best finds best bid and offer across books of the pair. Prices are those of
+// the exchange first found with them.
+func (p *pair) best() *BBO {
+	bbo := &BBO{Pair: p.name}
+	var bid, ask float64
+	var bidQuantity, askQuantity total
+	for _, b := range p.books {
+		if pl, price, ok := b.BestBid(); ok {
+			switch {
+			case bbo.BidExchanges == nil || price > bid:
+				bid, bidQuantity = price, total{}
+				bbo.BidPrice = pl.Price
+				bbo.BidExchanges = []string{b.Exchange}
+				bidQuantity.add(pl.Quantity)
+			case price == bid:
+				bbo.BidExchanges = append(bbo.BidExchanges, b.Exchange)
+				bidQuantity.add(pl.Quantity)
+			}
+		}
+		if pl, price, ok := b.BestAsk(); ok {
+			switch {
+			case bbo.AskExchanges == nil || price < ask:
+				ask, askQuantity = price, total{}
+				bbo.AskPrice = pl.Price
+				bbo.AskExchanges = []string{b.Exchange}
+				askQuantity.add(pl.Quantity)
+			case price == ask:
+				bbo.AskExchanges = append(bbo.AskExchanges, b.Exchange)
+				askQuantity.add(pl.Quantity)
+			}
+		}
+	}
+	if bbo.BidExchanges != nil {
+		bbo.BidQuantity = bidQuantity.String()
+	}
+	if bbo.AskExchanges != nil {
+		bbo.AskQuantity = askQuantity.String()
+	}
+	return bbo
+}
+
+func (bbo *BBO) same(other *BBO) bool {
+	return bbo.BidPrice == other.BidPrice && bbo.BidQuantity == other.BidQuantity &&
+		bbo.AskPrice == other.AskPrice && bbo.AskQuantity == other.AskQuantity &&
+		strings.Join(bbo.BidExchanges, "+") == strings.Join(other.BidExchanges, "+") &&
+		strings.Join(bbo.AskExchanges, "+") == strings.Join(other.AskExchanges, "+")
+}
+
+func ladder(levels map[float64]*Level, depth int, better func(p, q float64) bool) []*Level {
+	prices := make([]float64, 0, len(levels))
+	for price := range levels {
+		prices = append(prices, price)
+	}
+	sort.Slice(prices, func(i, j int) bool { return better(prices[i], prices[j]) })
+	if depth > 0 && depth < len(prices) {
+		prices = prices[:depth]
+	}
+	ll := make([]*Level, len(prices))
+	for i, price := range prices {
+		l := levels[price]
+		var quantity total
+		for _, v := range l.Venues {
+			quantity.add(v.Quantity)
+		}
+		l.Quantity = quantity.String()
+		ll[i] = l
+	}
+	return ll
+}
+
+// total sums up quantities given as strings, formatted to the most decimal
+// places of them, for float64 error not to get printed.
+type total struct {
+	sum      float64
+	decimals int
+	n        int
+	last     string
+}
+
+func (t *total) add(quantity string) {
+	q, _ := strconv.ParseFloat(quantity, 64)
+	t.sum += q
+	if i := strings.IndexByte(quantity, '.'); i >= 0 {
+		t.decimals = max(t.decimals, len(quantity)-i-1)
+	}
+	t.n++
+	t.last = quantity
+}
+
+func (t *total) String() string {
+	if t.n == 1 {
+		return t.last // As the exchange has it.
+	}
+	return strconv.FormatFloat(t.sum, 'f', t.decimals, 64)
+}
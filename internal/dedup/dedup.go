@@ -0,0 +1,109 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Trades passes through trades coming from in, dropping the ones already seen
+// among the last window trades of the same exchange and symbol. Trades are told
+// apart by their ids, or when there are none, by ids synthesized from their
+// time, price, quantity and taker side, and their ordinal among trades which
+// have all of those equal in the same batch. Amended trades are passed as is.
+func Trades(in <-chan []*exchange.Trade, window int) <-chan []*exchange.Trade {
+	out := make(chan []*exchange.Trade, 1)
+	go func() {
+		defer close(out)
+		seen := make(map[venue]*keys)
+		for trades := range in {
+			var unique []*exchange.Trade
+			for i, trade := range trades {
+				v := venue{trade.Exchange, trade.Symbol}
+				k := seen[v]
+				if k == nil {
+					k = newKeys(window)
+					seen[v] = k
+				}
+				if trade.Amended || k.add(tradeKey(trades, i)) {
+					if unique != nil {
+						unique = append(unique, trade)
+					}
+					continue
+				}
+				if unique == nil {
+					unique = append(make([]*exchange.Trade, 0, len(trades)), trades[:i]...)
+				}
+			}
+			if unique != nil {
+				trades = unique
+			}
+			if len(trades) > 0 {
+				out <- trades
+			}
+		}
+	}()
+	return out
+}
+
+type venue struct {
+	exchange string
+	symbol   string
+}
+
+func tradeKey(trades []*exchange.Trade, i int) int64 {
+	trade := trades[i]
+	if trade.TradeID != 0 {
+		return trade.TradeID
+	}
+	ordinal := 0
+	for _, t := range trades[:i] {
+		if t.Occurred == trade.Occurred && t.Price == trade.Price &&
+			t.Quantity == trade.Quantity && t.Taker == trade.Taker {
+			ordinal++
+		}
+	}
+	var b [8]byte
+	h := fnv.New64a()
+	binary.LittleEndian.PutUint64(b[:], uint64(trade.Occurred))
+	h.Write(b[:])
+	h.Write([]byte(trade.Price))
+	h.Write([]byte{0})
+	h.Write([]byte(trade.Quantity))
+	h.Write([]byte{0, byte(trade.Taker), byte(ordinal)})
+	return int64(h.Sum64())
+}
+
+// keys is a set of the last so many keys added.
+type keys struct {
+	ring []int64
+	next int
+	set  map[int64]struct{}
+}
+
+func newKeys(size int) *keys {
+	return &keys{
+		ring: make([]int64, 0, size),
+		set:  make(map[int64]struct{}, size),
+	}
+}
+
+// add adds key to the set, returning false if it is there already.
+func (k *keys) add(key int64) bool {
+	if _, ok := k.set[key]; ok {
+		return false
+	}
+	if cap(k.ring) == 0 {
+		return true
+	}
+	if len(k.ring) < cap(k.ring) {
+		k.ring = append(k.ring, key)
+	} else {
+		delete(k.set, k.ring[k.next])
+		k.ring[k.next] = key
+		k.next = (k.next + 1) % len(k.ring)
+	}
+	k.set[key] = struct{}{}
+	return true
+}
@@ -0,0 +1,77 @@
+package dedup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+func TestTrades(t *testing.T) {
+	withID := func(symbol string, id int64) *exchange.Trade {
+		return &exchange.Trade{Exchange: "Binance", Symbol: symbol, TradeID: id, Price: "100", Quantity: "1"}
+	}
+	// Kraken trades have no ids, ones being synthesized for them.
+	kraken := func(occurred timestamp.T, price, quantity string, taker exchange.Side) *exchange.Trade {
+		return &exchange.Trade{Exchange: "Kraken", Symbol: "XBT/USD", Occurred: occurred, Price: price, Quantity: quantity, Taker: taker}
+	}
+	amended := func(trade *exchange.Trade) *exchange.Trade {
+		a := *trade
+		a.Amended = true
+		return &a
+	}
+
+	t1, t2, t3 := withID("BTCUSDT", 1), withID("BTCUSDT", 2), withID("BTCUSDT", 3)
+	e1 := withID("ETHUSDT", 1)
+	k1 := kraken(1000, "16442.1", "0.1", exchange.Buy)
+	k2 := kraken(1000, "16442.1", "0.1", exchange.Sell)
+	k3 := kraken(1001, "16442.1", "0.1", exchange.Buy)
+	k1a, k1b := kraken(1000, "16442.1", "0.1", exchange.Buy), kraken(1000, "16442.1", "0.1", exchange.Buy)
+	a1 := amended(t1)
+
+	tests := []struct {
+		name   string
+		window int
+		in     [][]*exchange.Trade
+		want   [][]*exchange.Trade
+	}{
+		{"ids", 10,
+			[][]*exchange.Trade{{t1, t2}, {t2, t3}, {t1}},
+			[][]*exchange.Trade{{t1, t2}, {t3}}},
+		{"symbols apart", 10,
+			[][]*exchange.Trade{{t1}, {e1}},
+			[][]*exchange.Trade{{t1}, {e1}}},
+		{"amended", 10,
+			[][]*exchange.Trade{{t1}, {a1}},
+			[][]*exchange.Trade{{t1}, {a1}}},
+		{"synthesized ids", 10,
+			[][]*exchange.Trade{{k1, k2}, {k1, k2, k3}},
+			[][]*exchange.Trade{{k1, k2}, {k3}}},
+		{"identical in one batch", 10,
+			[][]*exchange.Trade{{k1, k1a}, {k1, k1a}, {k1, k1a, k1b}},
+			[][]*exchange.Trade{{k1, k1a}, {k1b}}},
+		{"window", 2,
+			[][]*exchange.Trade{{t1}, {t2}, {t1}, {t3}, {t1}},
+			[][]*exchange.Trade{{t1}, {t2}, {t3}, {t1}}},
+		{"no window", 0,
+			[][]*exchange.Trade{{t1}, {t1}},
+			[][]*exchange.Trade{{t1}, {t1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := make(chan []*exchange.Trade, len(tt.in))
+			for _, trades := range tt.in {
+				in <- trades
+			}
+			close(in)
+			var got [][]*exchange.Trade
+			for trades := range Trades(in, tt.window) {
+				got = append(got, trades)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("trades = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
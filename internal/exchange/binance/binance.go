@@ -1,9 +1,21 @@
 package binance
 
-import "github.com/oerlikon/sounding/internal/common"
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
 
 const exchName = "Binance"
 
 type Options struct {
-	Stderr common.Printlnfer
+	Logger zerolog.Logger
+
+	Buffer   int               // Book and trades channel capacity, 1 by default.
+	Overflow exchange.Overflow // What to do when they're full, block by default.
+
+	Depth int           // Depth snapshot limit, up to 5000.
+	Speed time.Duration // Depth stream update speed, 100ms or 1s.
 }
@@ -15,6 +15,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/oerlikon/fastjson"
+	"github.com/rs/zerolog"
 
 	. "github.com/oerlikon/sounding/internal/common"
 	"github.com/oerlikon/sounding/internal/common/timestamp"
@@ -26,15 +27,20 @@ const serverURL = "wss://stream.binance.com:9443/stream"
 type Listener struct {
 	symbol string
 	opts   Options
+	log    zerolog.Logger
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	bookCh   atomic.Value
 	tradesCh atomic.Value
+	tickerCh atomic.Value
 
-	ws     *websocket.Conn
-	parser fastjson.Parser
+	ws       *websocket.Conn
+	parser   fastjson.Parser
+	received atomic.Int64 // When the last message was received, as timestamp.T.
+	resyncCh chan struct{}
+	counters exchange.Counters
 
 	depth struct {
 		nextID   int64
@@ -45,8 +51,9 @@ type Listener struct {
 
 	subscribed struct {
 		sync.Mutex
-		depth bool
-		trade bool
+		depth      bool
+		trade      bool
+		bookTicker bool
 	}
 }
 
@@ -57,12 +64,17 @@ func NewListener(symbol string, options ...Option) exchange.Listener {
 			panic("binance: error setting options: " + err.Error())
 		}
 	}
-	if opts.Stderr == nil {
-		opts.Stderr = Silent
+	if opts.Buffer == 0 {
+		opts.Buffer = 1
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 1000
 	}
 	return &Listener{
-		symbol: symbol,
-		opts:   opts,
+		symbol:   symbol,
+		opts:     opts,
+		log:      opts.Logger.With().Str("exchange", exchName).Str("symbol", symbol).Logger(),
+		resyncCh: make(chan struct{}, 1),
 	}
 }
 
@@ -75,7 +87,7 @@ func (l *Listener) Symbol() string {
 }
 
 func (l *Listener) Start(ctx context.Context) error {
-	l.opts.Stderr.Printf("Starting listener binance:%s", l.symbol)
+	l.log.Info().Msg("Starting listener")
 	ws, _, err := websocket.DefaultDialer.Dial(serverURL, nil)
 	if err != nil {
 		return err
@@ -112,9 +124,14 @@ func (l *Listener) Start(ctx context.Context) error {
 		for {
 			select {
 			case msg := <-msgs:
+				l.received.Store(int64(timestamp.Stamp(time.Now())))
 				if err := l.process(msg); err != nil {
 					l.err(err)
 				}
+			case <-l.resyncCh:
+				if err := l.resync(); err != nil {
+					l.err(err)
+				}
 			case <-l.ctx.Done():
 				l.shutdown()
 				return
@@ -138,7 +155,7 @@ func (l *Listener) Book() <-chan *exchange.BookUpdate {
 		}
 		go l.fetchDepthSnapshot(l.ctx)
 	}
-	bookCh := make(chan *exchange.BookUpdate, 1)
+	bookCh := make(chan *exchange.BookUpdate, l.opts.Buffer)
 	l.bookCh.Store(bookCh)
 	return bookCh
 }
@@ -156,17 +173,69 @@ func (l *Listener) Trades() <-chan []*exchange.Trade {
 			return nil
 		}
 	}
-	tradesCh := make(chan []*exchange.Trade, 1)
+	tradesCh := make(chan []*exchange.Trade, l.opts.Buffer)
 	l.tradesCh.Store(tradesCh)
 	return tradesCh
 }
 
+func (l *Listener) Ticker() <-chan *exchange.Ticker {
+	if l.ctx == nil {
+		return nil
+	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		return tickerCh.(chan *exchange.Ticker)
+	}
+	if !l.subscribed.bookTicker {
+		if err := l.subscribeBookTicker(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	tickerCh := make(chan *exchange.Ticker, l.opts.Buffer)
+	l.tickerCh.Store(tickerCh)
+	return tickerCh
+}
+
+func (l *Listener) Status() *exchange.Status {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	var subscriptions []string
+	if l.subscribed.depth {
+		subscriptions = append(subscriptions, "depth")
+	}
+	if l.subscribed.trade {
+		subscriptions = append(subscriptions, "trade")
+	}
+	if l.subscribed.bookTicker {
+		subscriptions = append(subscriptions, "bookTicker")
+	}
+	return &exchange.Status{
+		Subscriptions: subscriptions,
+		Received:      timestamp.T(l.received.Load()),
+		Dropped:       l.counters.Dropped(),
+		Coalesced:     l.counters.Coalesced(),
+	}
+}
+
+// Resync makes books start over from snapshots.
+func (l *Listener) Resync() {
+	select {
+	case l.resyncCh <- struct{}{}:
+	default:
+	}
+}
+
 func (l *Listener) err(err error) {
-	l.opts.Stderr.Println("Error: binance:", err)
+	l.log.Error().Msg(err.Error())
 }
 
-func (l *Listener) warn(err error) {
-	l.opts.Stderr.Println("Warning: binance:", err)
+// disconnect stops the listener, its consumer not keeping up.
+func (l *Listener) disconnect() {
+	if l.ctx.Err() == nil {
+		l.log.Error().Msg("Channel full, disconnecting")
+		l.cancel()
+	}
 }
 
 func (l *Listener) sendWsMessage(msg string) error {
@@ -180,8 +249,7 @@ func (l *Listener) subscribeDepth() error {
 	if l.subscribed.depth {
 		return nil
 	}
-	msg := fmt.Sprintf(`{"method":"SUBSCRIBE","params":["%s@depth"],"id":1}`,
-		strings.ToLower(l.symbol))
+	msg := fmt.Sprintf(`{"method":"SUBSCRIBE","params":["%s"],"id":1}`, l.depthStream())
 	if err := l.sendWsMessage(msg); err != nil {
 		return err
 	}
@@ -196,14 +264,20 @@ func (l *Listener) unsubscribeDepth() {
 	if !l.subscribed.depth {
 		return
 	}
-	msg := fmt.Sprintf(`{"method":"UNSUBSCRIBE","params":["%s@depth"],"id":1}`,
-		strings.ToLower(l.symbol))
+	msg := fmt.Sprintf(`{"method":"UNSUBSCRIBE","params":["%s"],"id":1}`, l.depthStream())
 	if err := l.sendWsMessage(msg); err != nil {
 		return
 	}
 	l.subscribed.depth = false
 }
 
+func (l *Listener) depthStream() string {
+	if l.opts.Speed > 0 && l.opts.Speed < time.Second {
+		return fmt.Sprintf("%s@depth@%dms", strings.ToLower(l.symbol), l.opts.Speed.Milliseconds())
+	}
+	return fmt.Sprintf("%s@depth", strings.ToLower(l.symbol))
+}
+
 func (l *Listener) subscribeTrade() error {
 	l.subscribed.Lock()
 	defer l.subscribed.Unlock()
@@ -235,9 +309,40 @@ func (l *Listener) unsubscribeTrade() {
 	l.subscribed.trade = false
 }
 
+func (l *Listener) subscribeBookTicker() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.bookTicker {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"method":"SUBSCRIBE","params":["%s@bookTicker"],"id":3}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.bookTicker = true
+	return nil
+}
+
+func (l *Listener) unsubscribeBookTicker() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.bookTicker {
+		return
+	}
+	msg := fmt.Sprintf(`{"method":"UNSUBSCRIBE","params":["%s@bookTicker"],"id":3}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.subscribed.bookTicker = false
+}
+
 func (l *Listener) fetchDepthSnapshot(ctx context.Context) {
-	url := fmt.Sprintf("https://api.binance.com/api/v3/depth?symbol=%s&limit=1000",
-		strings.ToUpper(l.symbol))
+	url := fmt.Sprintf("https://api.binance.com/api/v3/depth?symbol=%s&limit=%d",
+		strings.ToUpper(l.symbol), l.opts.Depth)
 
 	req, err := http.NewRequestWithContext(l.ctx, "GET", url, nil)
 	if err != nil {
@@ -278,6 +383,28 @@ func (l *Listener) fetchDepthSnapshot(ctx context.Context) {
 	l.depth.snapshot.Store(snapshot)
 }
 
+// resync gets depth snapshot anew, buffering updates till it arrives.
+func (l *Listener) resync() error {
+	l.subscribed.Lock()
+	subscribed := l.subscribed.depth
+	l.subscribed.Unlock()
+	if subscribed {
+		l.resyncDepth()
+	}
+	return nil
+}
+
+func (l *Listener) resyncDepth() {
+	bookCh, _ := l.bookCh.Load().(chan *exchange.BookUpdate)
+	if !exchange.SendReset(bookCh, exchName, l.symbol, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+	l.depth.started = false
+	l.depth.updates = nil
+	l.depth.snapshot.Store((*DepthUpdateMessage)(nil))
+	go l.fetchDepthSnapshot(l.ctx)
+}
+
 func (l *Listener) process(msg []byte) error {
 	received := timestamp.Stamp(time.Now())
 	v, err := l.parser.ParseBytes(msg)
@@ -285,7 +412,7 @@ func (l *Listener) process(msg []byte) error {
 		return err
 	}
 	if stream := v.GetStringBytes("stream"); stream != nil {
-		if bytes.HasSuffix(stream, []byte("depth")) {
+		if bytes.Contains(stream, []byte("@depth")) {
 			du := l.parseDepthUpdate(v.Get("data"))
 			du.Received = received
 
@@ -309,6 +436,12 @@ func (l *Listener) process(msg []byte) error {
 			}
 			return nil
 		}
+		if bytes.HasSuffix(stream, []byte("@bookTicker")) {
+			tm := l.parseBookTicker(v.Get("data"))
+			tm.Timestamp, tm.Received = received, received
+			l.sendTicker(tm)
+			return nil
+		}
 		if bytes.HasSuffix(stream, []byte("trade")) {
 			trade := l.parseTrade(v.Get("data"))
 			trade.Received = received
@@ -323,7 +456,7 @@ func (l *Listener) process(msg []byte) error {
 	if bytes.Contains(msg, []byte("error")) {
 		return errors.New(string(msg))
 	}
-	l.warn(errors.New(string(msg)))
+	l.log.Warn().RawJSON("msg", msg).Msg("Unexpected message")
 	return nil
 }
 
@@ -349,13 +482,14 @@ func (l *Listener) parseDepthSnapshot(v *fastjson.Value) *DepthUpdateMessage {
 		FinalID: v.GetInt64("lastUpdateId"),
 		Bids:    bids,
 		Asks:    asks,
+		Kind:    exchange.Snapshot,
 	}
 }
 
 func (l *Listener) parseDepthUpdate(v *fastjson.Value) *DepthUpdateMessage {
 	firstID, finalID := v.GetInt64("U"), v.GetInt64("u")
 	if l.depth.nextID != 0 && l.depth.nextID != firstID {
-		l.warn(fmt.Errorf("missing depth updates %d:%d", l.depth.nextID, firstID))
+		l.log.Warn().Int64("next_id", l.depth.nextID).Int64("first_id", firstID).Msg("Missing depth updates")
 	}
 	l.depth.nextID = finalID + 1
 
@@ -390,13 +524,17 @@ func (l *Listener) sendDepthUpdate(du *DepthUpdateMessage) {
 	if bookCh == nil || bookCh.(chan *exchange.BookUpdate) == nil {
 		return
 	}
-	bookCh.(chan *exchange.BookUpdate) <- &exchange.BookUpdate{
+	update := &exchange.BookUpdate{
 		Exchange:  exchName,
 		Symbol:    l.symbol,
 		Timestamp: du.Timestamp,
 		Received:  du.Received,
 		Bids:      du.Bids,
 		Asks:      du.Asks,
+		Kind:      du.Kind,
+	}
+	if !exchange.SendBook(bookCh.(chan *exchange.BookUpdate), update, l.opts.Overflow, &l.counters) {
+		l.disconnect()
 	}
 }
 
@@ -418,7 +556,7 @@ func (l *Listener) sendTrade(trade *TradeMessage) {
 	if tradesCh == nil || tradesCh.(chan []*exchange.Trade) == nil {
 		return
 	}
-	tradesCh.(chan []*exchange.Trade) <- []*exchange.Trade{
+	trades := []*exchange.Trade{
 		{
 			Exchange:    exchName,
 			Symbol:      l.symbol,
@@ -438,10 +576,42 @@ func (l *Listener) sendTrade(trade *TradeMessage) {
 			}(),
 		},
 	}
+	if !exchange.SendTrades(tradesCh.(chan []*exchange.Trade), trades, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *Listener) parseBookTicker(v *fastjson.Value) *TickerMessage {
+	return &TickerMessage{
+		BidPrice:    v.Get("b").S(),
+		BidQuantity: v.Get("B").S(),
+		AskPrice:    v.Get("a").S(),
+		AskQuantity: v.Get("A").S(),
+	}
+}
+
+func (l *Listener) sendTicker(tm *TickerMessage) {
+	tickerCh := l.tickerCh.Load()
+	if tickerCh == nil || tickerCh.(chan *exchange.Ticker) == nil {
+		return
+	}
+	ticker := &exchange.Ticker{
+		Exchange:    exchName,
+		Symbol:      l.symbol,
+		Timestamp:   tm.Timestamp,
+		Received:    tm.Received,
+		BidPrice:    tm.BidPrice,
+		BidQuantity: tm.BidQuantity,
+		AskPrice:    tm.AskPrice,
+		AskQuantity: tm.AskQuantity,
+	}
+	if !exchange.SendLatest(tickerCh.(chan *exchange.Ticker), ticker, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
 }
 
 func (l *Listener) shutdown() {
-	l.opts.Stderr.Printf("Stopping listener binance:%s", l.symbol)
+	l.log.Info().Msg("Stopping listener")
 	if bookCh := l.bookCh.Load(); bookCh != nil && bookCh.(chan *exchange.BookUpdate) != nil {
 		l.unsubscribeDepth()
 		close(bookCh.(chan *exchange.BookUpdate))
@@ -452,6 +622,11 @@ func (l *Listener) shutdown() {
 		close(tradesCh.(chan []*exchange.Trade))
 		l.tradesCh.Store((chan []*exchange.Trade)(nil))
 	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		l.unsubscribeBookTicker()
+		close(tickerCh.(chan *exchange.Ticker))
+		l.tickerCh.Store((chan *exchange.Ticker)(nil))
+	}
 	l.ws.Close()
 	l.cancel()
 }
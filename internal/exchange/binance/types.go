@@ -14,6 +14,8 @@ type DepthUpdateMessage struct {
 
 	Bids []exchange.PriceLevelUpdate
 	Asks []exchange.PriceLevelUpdate
+
+	Kind exchange.UpdateKind // Snapshot, or delta by default.
 }
 
 type TradeMessage struct {
@@ -29,3 +31,13 @@ type TradeMessage struct {
 	Quantity string
 	MakerBuy bool
 }
+
+type TickerMessage struct {
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	BidPrice    string
+	BidQuantity string
+	AskPrice    string
+	AskQuantity string
+}
@@ -0,0 +1,21 @@
+package binancefutures
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+const exchName = "BinanceFutures"
+
+type Options struct {
+	Logger zerolog.Logger
+
+	Buffer   int               // Book and trades channel capacity, 1 by default.
+	Overflow exchange.Overflow // What to do when they're full, block by default.
+
+	Depth int           // Depth snapshot limit, up to 1000.
+	Speed time.Duration // Depth stream update speed, 100ms, 250ms or 500ms.
+}
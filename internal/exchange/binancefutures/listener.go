@@ -0,0 +1,862 @@
+package binancefutures
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/oerlikon/fastjson"
+	"github.com/rs/zerolog"
+
+	. "github.com/oerlikon/sounding/internal/common"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+const serverURL = "wss://fstream.binance.com/stream"
+
+type Listener struct {
+	symbol string
+	opts   Options
+	log    zerolog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	bookCh         atomic.Value
+	tradesCh       atomic.Value
+	markPriceCh    atomic.Value
+	liquidationsCh atomic.Value
+	tickerCh       atomic.Value
+
+	ws       *websocket.Conn
+	parser   fastjson.Parser
+	received atomic.Int64 // When the last message was received, as timestamp.T.
+	resyncCh chan struct{}
+	counters exchange.Counters
+
+	depth struct {
+		lastID   int64
+		updates  []*DepthUpdateMessage
+		snapshot atomic.Value
+		started  bool
+	}
+
+	subscribed struct {
+		sync.Mutex
+		depth      bool
+		aggTrade   bool
+		markPrice  bool
+		forceOrder bool
+		bookTicker bool
+	}
+}
+
+func NewListener(symbol string, options ...Option) exchange.Listener {
+	var opts Options
+	for _, opt := range options {
+		if err := opt(&opts); err != nil {
+			panic("binancefutures: error setting options: " + err.Error())
+		}
+	}
+	if opts.Buffer == 0 {
+		opts.Buffer = 1
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 1000
+	}
+	return &Listener{
+		symbol:   symbol,
+		opts:     opts,
+		log:      opts.Logger.With().Str("exchange", exchName).Str("symbol", symbol).Logger(),
+		resyncCh: make(chan struct{}, 1),
+	}
+}
+
+func (l *Listener) Exchange() string {
+	return exchName
+}
+
+func (l *Listener) Symbol() string {
+	return l.symbol
+}
+
+func (l *Listener) Start(ctx context.Context) error {
+	l.log.Info().Msg("Starting listener")
+	ws, _, err := websocket.DefaultDialer.Dial(serverURL, nil)
+	if err != nil {
+		return err
+	}
+	l.ws = ws
+
+	l.ctx, l.cancel = context.WithCancel(ctx)
+
+	msgs := make(chan []byte, 1)
+	go func() {
+		errcount := 0
+		for {
+			if l.ctx.Err() != nil {
+				return
+			}
+			_, msg, err := l.ws.ReadMessage()
+			if err == nil {
+				if len(msg) > 0 {
+					msgs <- msg
+				}
+				errcount = 0
+				continue
+			}
+			if errors.Is(err, net.ErrClosed) && l.ctx.Err() != nil {
+				return
+			}
+			l.err(err)
+			if errcount++; errcount == 5 {
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case msg := <-msgs:
+				l.received.Store(int64(timestamp.Stamp(time.Now())))
+				if err := l.process(msg); err != nil {
+					l.err(err)
+				}
+			case <-l.resyncCh:
+				if err := l.resync(); err != nil {
+					l.err(err)
+				}
+			case <-l.ctx.Done():
+				l.shutdown()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (l *Listener) Book() <-chan *exchange.BookUpdate {
+	if l.ctx == nil {
+		return nil
+	}
+	if bookCh := l.bookCh.Load(); bookCh != nil && bookCh.(chan *exchange.BookUpdate) != nil {
+		return bookCh.(chan *exchange.BookUpdate)
+	}
+	if !l.subscribed.depth {
+		if err := l.subscribeDepth(); err != nil {
+			l.err(err)
+			return nil
+		}
+		go l.fetchDepthSnapshot(l.ctx)
+	}
+	bookCh := make(chan *exchange.BookUpdate, l.opts.Buffer)
+	l.bookCh.Store(bookCh)
+	return bookCh
+}
+
+func (l *Listener) Trades() <-chan []*exchange.Trade {
+	if l.ctx == nil {
+		return nil
+	}
+	if tradesCh := l.tradesCh.Load(); tradesCh != nil && tradesCh.(chan []*exchange.Trade) != nil {
+		return tradesCh.(chan []*exchange.Trade)
+	}
+	if !l.subscribed.aggTrade {
+		if err := l.subscribeAggTrade(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	tradesCh := make(chan []*exchange.Trade, l.opts.Buffer)
+	l.tradesCh.Store(tradesCh)
+	return tradesCh
+}
+
+func (l *Listener) MarkPrice() <-chan *exchange.MarkPriceUpdate {
+	if l.ctx == nil {
+		return nil
+	}
+	if markPriceCh := l.markPriceCh.Load(); markPriceCh != nil && markPriceCh.(chan *exchange.MarkPriceUpdate) != nil {
+		return markPriceCh.(chan *exchange.MarkPriceUpdate)
+	}
+	if !l.subscribed.markPrice {
+		if err := l.subscribeMarkPrice(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	markPriceCh := make(chan *exchange.MarkPriceUpdate, l.opts.Buffer)
+	l.markPriceCh.Store(markPriceCh)
+	return markPriceCh
+}
+
+func (l *Listener) Liquidations() <-chan []*exchange.Liquidation {
+	if l.ctx == nil {
+		return nil
+	}
+	if liquidationsCh := l.liquidationsCh.Load(); liquidationsCh != nil && liquidationsCh.(chan []*exchange.Liquidation) != nil {
+		return liquidationsCh.(chan []*exchange.Liquidation)
+	}
+	if !l.subscribed.forceOrder {
+		if err := l.subscribeForceOrder(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	liquidationsCh := make(chan []*exchange.Liquidation, l.opts.Buffer)
+	l.liquidationsCh.Store(liquidationsCh)
+	return liquidationsCh
+}
+
+func (l *Listener) Ticker() <-chan *exchange.Ticker {
+	if l.ctx == nil {
+		return nil
+	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		return tickerCh.(chan *exchange.Ticker)
+	}
+	if !l.subscribed.bookTicker {
+		if err := l.subscribeBookTicker(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	tickerCh := make(chan *exchange.Ticker, l.opts.Buffer)
+	l.tickerCh.Store(tickerCh)
+	return tickerCh
+}
+
+func (l *Listener) Status() *exchange.Status {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	var subscriptions []string
+	if l.subscribed.depth {
+		subscriptions = append(subscriptions, "depth")
+	}
+	if l.subscribed.aggTrade {
+		subscriptions = append(subscriptions, "aggTrade")
+	}
+	if l.subscribed.markPrice {
+		subscriptions = append(subscriptions, "markPrice")
+	}
+	if l.subscribed.forceOrder {
+		subscriptions = append(subscriptions, "forceOrder")
+	}
+	if l.subscribed.bookTicker {
+		subscriptions = append(subscriptions, "bookTicker")
+	}
+	return &exchange.Status{
+		Subscriptions: subscriptions,
+		Received:      timestamp.T(l.received.Load()),
+		Dropped:       l.counters.Dropped(),
+		Coalesced:     l.counters.Coalesced(),
+	}
+}
+
+// Resync makes books start over from snapshots.
+func (l *Listener) Resync() {
+	select {
+	case l.resyncCh <- struct{}{}:
+	default:
+	}
+}
+
+func (l *Listener) err(err error) {
+	l.log.Error().Msg(err.Error())
+}
+
+// disconnect stops the listener, its consumer not keeping up.
+func (l *Listener) disconnect() {
+	if l.ctx.Err() == nil {
+		l.log.Error().Msg("Channel full, disconnecting")
+		l.cancel()
+	}
+}
+
+func (l *Listener) sendWsMessage(msg string) error {
+	return l.ws.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+func (l *Listener) subscribeDepth() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.depth {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"method":"SUBSCRIBE","params":["%s"],"id":1}`, l.depthStream())
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.depth = true
+	return nil
+}
+
+func (l *Listener) unsubscribeDepth() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.depth {
+		return
+	}
+	msg := fmt.Sprintf(`{"method":"UNSUBSCRIBE","params":["%s"],"id":1}`, l.depthStream())
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.subscribed.depth = false
+}
+
+func (l *Listener) depthStream() string {
+	if l.opts.Speed > 0 && l.opts.Speed != 250*time.Millisecond {
+		return fmt.Sprintf("%s@depth@%dms", strings.ToLower(l.symbol), l.opts.Speed.Milliseconds())
+	}
+	return fmt.Sprintf("%s@depth", strings.ToLower(l.symbol))
+}
+
+func (l *Listener) subscribeAggTrade() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.aggTrade {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"method":"SUBSCRIBE","params":["%s@aggTrade"],"id":2}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.aggTrade = true
+	return nil
+}
+
+func (l *Listener) unsubscribeAggTrade() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.aggTrade {
+		return
+	}
+	msg := fmt.Sprintf(`{"method":"UNSUBSCRIBE","params":["%s@aggTrade"],"id":2}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.subscribed.aggTrade = false
+}
+
+func (l *Listener) subscribeMarkPrice() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.markPrice {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"method":"SUBSCRIBE","params":["%s@markPrice@1s"],"id":3}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.markPrice = true
+	return nil
+}
+
+func (l *Listener) unsubscribeMarkPrice() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.markPrice {
+		return
+	}
+	msg := fmt.Sprintf(`{"method":"UNSUBSCRIBE","params":["%s@markPrice@1s"],"id":3}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.subscribed.markPrice = false
+}
+
+func (l *Listener) subscribeForceOrder() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.forceOrder {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"method":"SUBSCRIBE","params":["%s@forceOrder"],"id":4}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.forceOrder = true
+	return nil
+}
+
+func (l *Listener) unsubscribeForceOrder() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.forceOrder {
+		return
+	}
+	msg := fmt.Sprintf(`{"method":"UNSUBSCRIBE","params":["%s@forceOrder"],"id":4}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.subscribed.forceOrder = false
+}
+
+func (l *Listener) subscribeBookTicker() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.bookTicker {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"method":"SUBSCRIBE","params":["%s@bookTicker"],"id":5}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.bookTicker = true
+	return nil
+}
+
+func (l *Listener) unsubscribeBookTicker() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.bookTicker {
+		return
+	}
+	msg := fmt.Sprintf(`{"method":"UNSUBSCRIBE","params":["%s@bookTicker"],"id":5}`,
+		strings.ToLower(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.subscribed.bookTicker = false
+}
+
+func (l *Listener) fetchDepthSnapshot(ctx context.Context) {
+	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/depth?symbol=%s&limit=%d",
+		strings.ToUpper(l.symbol), l.opts.Depth)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		l.err(err)
+		return
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		l.err(err)
+		return
+	}
+	received := timestamp.Stamp(time.Now())
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		l.err(err)
+		return
+	}
+
+	if bytes.Contains(body, []byte("Illegal")) {
+		l.err(errors.New(string(body)))
+		return
+	}
+	if bytes.Contains(body, []byte("Invalid")) {
+		l.err(errors.New(string(body)))
+		return
+	}
+
+	var parser fastjson.Parser
+	v, err := parser.ParseBytes(body)
+	if err != nil {
+		l.err(err)
+		return
+	}
+	snapshot := l.parseDepthSnapshot(v)
+	if snapshot.Timestamp == 0 {
+		snapshot.Timestamp = received
+	}
+	snapshot.Received = received
+	l.depth.snapshot.Store(snapshot)
+}
+
+// resync gets depth snapshot anew, buffering updates till it arrives.
+func (l *Listener) resync() error {
+	l.subscribed.Lock()
+	subscribed := l.subscribed.depth
+	l.subscribed.Unlock()
+	if subscribed {
+		l.resyncDepth()
+	}
+	return nil
+}
+
+// resyncDepth drops whatever depth updates have been collected so far and
+// starts over from a fresh snapshot.
+func (l *Listener) resyncDepth() {
+	bookCh, _ := l.bookCh.Load().(chan *exchange.BookUpdate)
+	if !exchange.SendReset(bookCh, exchName, l.symbol, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+	l.depth.started = false
+	l.depth.updates = nil
+	l.depth.snapshot.Store((*DepthUpdateMessage)(nil))
+	go l.fetchDepthSnapshot(l.ctx)
+}
+
+func (l *Listener) process(msg []byte) error {
+	received := timestamp.Stamp(time.Now())
+	v, err := l.parser.ParseBytes(msg)
+	if err != nil {
+		return err
+	}
+	if data := v.Get("data"); data != nil {
+		event := data.GetStringBytes("e")
+		switch {
+		case bytes.Equal(event, []byte("depthUpdate")):
+			du := l.parseDepthUpdate(data)
+			du.Received = received
+
+			if l.depth.started {
+				if du.PrevID != l.depth.lastID {
+					l.log.Warn().Int64("last_id", l.depth.lastID).Int64("prev_id", du.PrevID).Msg("Missing depth updates, resyncing")
+					l.resyncDepth()
+					l.depth.updates = append(l.depth.updates, du)
+					return nil
+				}
+				l.depth.lastID = du.FinalID
+				l.sendDepthUpdate(du)
+				return nil
+			}
+			l.depth.updates = append(l.depth.updates, du)
+			if ds := l.depth.snapshot.Load(); ds != nil && ds.(*DepthUpdateMessage) != nil {
+				snapshot := ds.(*DepthUpdateMessage)
+				updates := l.depth.updates[:0]
+				for _, du := range l.depth.updates {
+					if du.FinalID < snapshot.FinalID {
+						continue
+					}
+					updates = append(updates, du)
+				}
+				if len(updates) == 0 {
+					return nil
+				}
+				if updates[0].FirstID > snapshot.FinalID {
+					l.log.Warn().Int64("snapshot_id", snapshot.FinalID).Int64("first_id", updates[0].FirstID).
+						Msg("Depth snapshot is behind updates, resyncing")
+					l.resyncDepth()
+					l.depth.updates = updates
+					return nil
+				}
+				l.sendDepthUpdate(snapshot)
+				l.depth.lastID = updates[0].PrevID
+				for _, du := range updates {
+					if du.PrevID != l.depth.lastID {
+						l.log.Warn().Int64("last_id", l.depth.lastID).Int64("prev_id", du.PrevID).Msg("Missing depth updates, resyncing")
+						l.resyncDepth()
+						return nil
+					}
+					l.sendDepthUpdate(du)
+					l.depth.lastID = du.FinalID
+				}
+				l.depth.updates = nil
+				l.depth.snapshot.Store((*DepthUpdateMessage)(nil))
+				l.depth.started = true
+			}
+			return nil
+		case bytes.Equal(event, []byte("aggTrade")):
+			trade := l.parseTrade(data)
+			trade.Received = received
+			l.sendTrade(trade)
+			return nil
+		case bytes.Equal(event, []byte("bookTicker")):
+			tm := l.parseBookTicker(data)
+			tm.Received = received
+			l.sendTicker(tm)
+			return nil
+		case bytes.Equal(event, []byte("markPriceUpdate")):
+			mp := l.parseMarkPrice(data)
+			mp.Received = received
+			l.sendMarkPrice(mp)
+			return nil
+		case bytes.Equal(event, []byte("forceOrder")):
+			fo := l.parseForceOrder(data)
+			fo.Received = received
+			l.sendLiquidation(fo)
+			return nil
+		}
+		// fallthrough
+	}
+	if result := v.Get("result"); result != nil {
+		return nil
+	}
+	if bytes.Contains(msg, []byte("error")) {
+		return errors.New(string(msg))
+	}
+	l.log.Warn().RawJSON("msg", msg).Msg("Unexpected message")
+	return nil
+}
+
+func (l *Listener) parseDepthSnapshot(v *fastjson.Value) *DepthUpdateMessage {
+	var bids, asks []exchange.PriceLevelUpdate
+
+	if b := v.GetArray("bids"); b != nil {
+		bids = make([]exchange.PriceLevelUpdate, len(b))
+		for i, pq := range b {
+			bids[i].Price = pq.GetArray()[0].S()
+			bids[i].Quantity = pq.GetArray()[1].S()
+		}
+	}
+	if a := v.GetArray("asks"); a != nil {
+		asks = make([]exchange.PriceLevelUpdate, len(a))
+		for i, pq := range a {
+			asks[i].Price = pq.GetArray()[0].S()
+			asks[i].Quantity = pq.GetArray()[1].S()
+		}
+	}
+
+	return &DepthUpdateMessage{
+		Timestamp: timestamp.Milli(v.GetInt64("E")),
+		FinalID:   v.GetInt64("lastUpdateId"),
+		Bids:      bids,
+		Asks:      asks,
+		Kind:      exchange.Snapshot,
+	}
+}
+
+func (l *Listener) parseDepthUpdate(v *fastjson.Value) *DepthUpdateMessage {
+	var bids, asks []exchange.PriceLevelUpdate
+
+	if b := v.GetArray("b"); b != nil {
+		bids = make([]exchange.PriceLevelUpdate, len(b))
+		for i, pq := range b {
+			bids[i].Price = pq.GetArray()[0].S()
+			bids[i].Quantity = pq.GetArray()[1].S()
+		}
+	}
+	if a := v.GetArray("a"); a != nil {
+		asks = make([]exchange.PriceLevelUpdate, len(a))
+		for i, pq := range a {
+			asks[i].Price = pq.GetArray()[0].S()
+			asks[i].Quantity = pq.GetArray()[1].S()
+		}
+	}
+
+	return &DepthUpdateMessage{
+		Timestamp: timestamp.Milli(v.GetInt64("E")),
+		FirstID:   v.GetInt64("U"),
+		FinalID:   v.GetInt64("u"),
+		PrevID:    v.GetInt64("pu"),
+		Bids:      bids,
+		Asks:      asks,
+	}
+}
+
+func (l *Listener) sendDepthUpdate(du *DepthUpdateMessage) {
+	bookCh := l.bookCh.Load()
+	if bookCh == nil || bookCh.(chan *exchange.BookUpdate) == nil {
+		return
+	}
+	update := &exchange.BookUpdate{
+		Exchange:  exchName,
+		Symbol:    l.symbol,
+		Timestamp: du.Timestamp,
+		Received:  du.Received,
+		Bids:      du.Bids,
+		Asks:      du.Asks,
+		Kind:      du.Kind,
+	}
+	if !exchange.SendBook(bookCh.(chan *exchange.BookUpdate), update, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *Listener) parseTrade(v *fastjson.Value) *TradeMessage {
+	return &TradeMessage{
+		Timestamp:    timestamp.Milli(v.GetInt64("E")),
+		Occurred:     timestamp.Milli(v.GetInt64("T")),
+		AggTradeID:   v.GetInt64("a"),
+		FirstTradeID: v.GetInt64("f"),
+		LastTradeID:  v.GetInt64("l"),
+		Price:        v.Get("p").S(),
+		Quantity:     v.Get("q").S(),
+		MakerBuy:     v.GetBool("m"),
+	}
+}
+
+func (l *Listener) sendTrade(trade *TradeMessage) {
+	tradesCh := l.tradesCh.Load()
+	if tradesCh == nil || tradesCh.(chan []*exchange.Trade) == nil {
+		return
+	}
+	trades := []*exchange.Trade{
+		{
+			Exchange:  exchName,
+			Symbol:    l.symbol,
+			Timestamp: trade.Timestamp,
+			Received:  trade.Received,
+			Occurred:  trade.Occurred,
+			TradeID:   trade.AggTradeID,
+			Price:     trade.Price,
+			Quantity:  trade.Quantity,
+			Taker: func() exchange.Side {
+				if trade.MakerBuy {
+					return exchange.Sell
+				}
+				return exchange.Buy
+			}(),
+		},
+	}
+	if !exchange.SendTrades(tradesCh.(chan []*exchange.Trade), trades, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *Listener) parseMarkPrice(v *fastjson.Value) *MarkPriceMessage {
+	return &MarkPriceMessage{
+		Timestamp:   timestamp.Milli(v.GetInt64("E")),
+		MarkPrice:   v.Get("p").S(),
+		IndexPrice:  v.Get("i").S(),
+		SettlePrice: v.Get("P").S(),
+		FundingRate: v.Get("r").S(),
+		FundingTime: timestamp.Milli(v.GetInt64("T")),
+	}
+}
+
+func (l *Listener) sendMarkPrice(mp *MarkPriceMessage) {
+	markPriceCh := l.markPriceCh.Load()
+	if markPriceCh == nil || markPriceCh.(chan *exchange.MarkPriceUpdate) == nil {
+		return
+	}
+	update := &exchange.MarkPriceUpdate{
+		Exchange:    exchName,
+		Symbol:      l.symbol,
+		Timestamp:   mp.Timestamp,
+		Received:    mp.Received,
+		MarkPrice:   mp.MarkPrice,
+		IndexPrice:  mp.IndexPrice,
+		SettlePrice: mp.SettlePrice,
+		FundingRate: mp.FundingRate,
+		FundingTime: mp.FundingTime,
+	}
+	if !exchange.SendLatest(markPriceCh.(chan *exchange.MarkPriceUpdate), update, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *Listener) parseForceOrder(v *fastjson.Value) *ForceOrderMessage {
+	o := v.Get("o")
+	return &ForceOrderMessage{
+		Timestamp: timestamp.Milli(v.GetInt64("E")),
+		Occurred:  timestamp.Milli(o.GetInt64("T")),
+		Side:      string(o.GetStringBytes("S")),
+		Price:     o.Get("p").S(),
+		AvgPrice:  o.Get("ap").S(),
+		Quantity:  o.Get("q").S(),
+		Filled:    o.Get("z").S(),
+		Status:    string(o.GetStringBytes("X")),
+	}
+}
+
+func (l *Listener) sendLiquidation(fo *ForceOrderMessage) {
+	liquidationsCh := l.liquidationsCh.Load()
+	if liquidationsCh == nil || liquidationsCh.(chan []*exchange.Liquidation) == nil {
+		return
+	}
+	liquidation := &exchange.Liquidation{
+		Exchange:  exchName,
+		Symbol:    l.symbol,
+		Timestamp: fo.Timestamp,
+		Received:  fo.Received,
+		Occurred:  fo.Occurred,
+		Side: func() exchange.Side {
+			if fo.Side == "BUY" {
+				return exchange.Buy
+			}
+			return exchange.Sell
+		}(),
+		Price:    fo.Price,
+		AvgPrice: fo.AvgPrice,
+		Quantity: fo.Quantity,
+		Filled:   fo.Filled,
+		Status:   fo.Status,
+	}
+	if !exchange.SendLiquidations(liquidationsCh.(chan []*exchange.Liquidation), []*exchange.Liquidation{liquidation}, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *Listener) parseBookTicker(v *fastjson.Value) *TickerMessage {
+	return &TickerMessage{
+		Timestamp:   timestamp.Milli(v.GetInt64("T")),
+		BidPrice:    v.Get("b").S(),
+		BidQuantity: v.Get("B").S(),
+		AskPrice:    v.Get("a").S(),
+		AskQuantity: v.Get("A").S(),
+	}
+}
+
+func (l *Listener) sendTicker(tm *TickerMessage) {
+	tickerCh := l.tickerCh.Load()
+	if tickerCh == nil || tickerCh.(chan *exchange.Ticker) == nil {
+		return
+	}
+	ticker := &exchange.Ticker{
+		Exchange:    exchName,
+		Symbol:      l.symbol,
+		Timestamp:   tm.Timestamp,
+		Received:    tm.Received,
+		BidPrice:    tm.BidPrice,
+		BidQuantity: tm.BidQuantity,
+		AskPrice:    tm.AskPrice,
+		AskQuantity: tm.AskQuantity,
+	}
+	if !exchange.SendLatest(tickerCh.(chan *exchange.Ticker), ticker, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *Listener) shutdown() {
+	l.log.Info().Msg("Stopping listener")
+	if bookCh := l.bookCh.Load(); bookCh != nil && bookCh.(chan *exchange.BookUpdate) != nil {
+		l.unsubscribeDepth()
+		close(bookCh.(chan *exchange.BookUpdate))
+		l.bookCh.Store((chan *exchange.BookUpdate)(nil))
+	}
+	if tradesCh := l.tradesCh.Load(); tradesCh != nil && tradesCh.(chan []*exchange.Trade) != nil {
+		l.unsubscribeAggTrade()
+		close(tradesCh.(chan []*exchange.Trade))
+		l.tradesCh.Store((chan []*exchange.Trade)(nil))
+	}
+	if markPriceCh := l.markPriceCh.Load(); markPriceCh != nil && markPriceCh.(chan *exchange.MarkPriceUpdate) != nil {
+		l.unsubscribeMarkPrice()
+		close(markPriceCh.(chan *exchange.MarkPriceUpdate))
+		l.markPriceCh.Store((chan *exchange.MarkPriceUpdate)(nil))
+	}
+	if liquidationsCh := l.liquidationsCh.Load(); liquidationsCh != nil && liquidationsCh.(chan []*exchange.Liquidation) != nil {
+		l.unsubscribeForceOrder()
+		close(liquidationsCh.(chan []*exchange.Liquidation))
+		l.liquidationsCh.Store((chan []*exchange.Liquidation)(nil))
+	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		l.unsubscribeBookTicker()
+		close(tickerCh.(chan *exchange.Ticker))
+		l.tickerCh.Store((chan *exchange.Ticker)(nil))
+	}
+	l.ws.Close()
+	l.cancel()
+}
@@ -0,0 +1,69 @@
+package binancefutures
+
+import (
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+type DepthUpdateMessage struct {
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	FirstID int64
+	FinalID int64
+	PrevID  int64
+
+	Bids []exchange.PriceLevelUpdate
+	Asks []exchange.PriceLevelUpdate
+
+	Kind exchange.UpdateKind // Snapshot, or delta by default.
+}
+
+type TradeMessage struct {
+	Timestamp timestamp.T
+	Received  timestamp.T
+	Occurred  timestamp.T
+
+	AggTradeID   int64
+	FirstTradeID int64
+	LastTradeID  int64
+
+	Price    string
+	Quantity string
+	MakerBuy bool
+}
+
+type MarkPriceMessage struct {
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	MarkPrice   string
+	IndexPrice  string
+	SettlePrice string
+
+	FundingRate string
+	FundingTime timestamp.T
+}
+
+type ForceOrderMessage struct {
+	Timestamp timestamp.T
+	Received  timestamp.T
+	Occurred  timestamp.T
+
+	Side     string
+	Price    string
+	AvgPrice string
+	Quantity string
+	Filled   string
+	Status   string
+}
+
+type TickerMessage struct {
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	BidPrice    string
+	BidQuantity string
+	AskPrice    string
+	AskQuantity string
+}
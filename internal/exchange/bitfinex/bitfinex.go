@@ -1,9 +1,22 @@
 package bitfinex
 
-import "github.com/oerlikon/sounding/internal/common"
+import (
+	"github.com/rs/zerolog"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
 
 const exchName = "Bitfinex"
 
 type Options struct {
-	Stderr common.Printlnfer
+	Logger zerolog.Logger
+
+	Buffer   int               // Book and trades channel capacity, 1 by default.
+	Overflow exchange.Overflow // What to do when they're full, block by default.
+
+	Depth     int    // Book length, 1, 25, 100 or 250.
+	Frequency string // Book update frequency, F0 or F1.
+	Precision string // Book price aggregation level, P0 to P4.
+
+	FinalTrades bool // Emit trades on "tu" messages only, not on "te".
 }
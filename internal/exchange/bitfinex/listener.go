@@ -13,6 +13,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/oerlikon/fastjson"
+	"github.com/rs/zerolog"
 
 	. "github.com/oerlikon/sounding/internal/common"
 	"github.com/oerlikon/sounding/internal/common/timestamp"
@@ -21,18 +22,27 @@ import (
 
 const serverURL = "wss://api-pub.bitfinex.com/ws/2"
 
+// How many recent trades to keep around to compare "tu" messages against.
+const recentTrades = 1000
+
 type Listener struct {
 	symbol string
 	opts   Options
+	log    zerolog.Logger
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	bookCh   atomic.Value
 	tradesCh atomic.Value
+	ordersCh atomic.Value
+	tickerCh atomic.Value
 
-	ws     *websocket.Conn
-	parser fastjson.Parser
+	ws       *websocket.Conn
+	parser   fastjson.Parser
+	received atomic.Int64 // When the last message was received, as timestamp.T.
+	resyncCh chan struct{}
+	counters exchange.Counters
 
 	book struct {
 		chanID  atomic.Value
@@ -42,12 +52,26 @@ type Listener struct {
 	trades struct {
 		chanID  atomic.Value
 		started bool
+		recent  map[int64]*TradeMessage
+		ids     []int64
+	}
+
+	ticker struct {
+		chanID atomic.Value
+	}
+
+	rawBook struct {
+		chanID  atomic.Value
+		started bool
+		orders  map[int64]string // Order prices by id.
 	}
 
 	subscribed struct {
 		sync.Mutex
-		book   bool
-		trades bool
+		book    bool
+		trades  bool
+		rawBook bool
+		ticker  bool
 	}
 
 	nextSeq int64
@@ -60,12 +84,23 @@ func NewListener(symbol string, options ...Option) exchange.Listener {
 			panic("bitfinex: error setting options: " + err.Error())
 		}
 	}
-	if opts.Stderr == nil {
-		opts.Stderr = Silent
+	if opts.Buffer == 0 {
+		opts.Buffer = 1
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 250
+	}
+	if opts.Frequency == "" {
+		opts.Frequency = "F0"
+	}
+	if opts.Precision == "" {
+		opts.Precision = "P0"
 	}
 	return &Listener{
-		symbol: symbol,
-		opts:   opts,
+		symbol:   symbol,
+		opts:     opts,
+		log:      opts.Logger.With().Str("exchange", exchName).Str("symbol", symbol).Logger(),
+		resyncCh: make(chan struct{}, 1),
 	}
 }
 
@@ -78,7 +113,7 @@ func (l *Listener) Symbol() string {
 }
 
 func (l *Listener) Start(ctx context.Context) error {
-	l.opts.Stderr.Printf("Starting listener bitfinex:%s", l.symbol)
+	l.log.Info().Msg("Starting listener")
 	ws, _, err := websocket.DefaultDialer.Dial(serverURL, nil)
 	if err != nil {
 		return err
@@ -119,9 +154,14 @@ func (l *Listener) Start(ctx context.Context) error {
 		for {
 			select {
 			case msg := <-msgs:
+				l.received.Store(int64(timestamp.Stamp(time.Now())))
 				if err := l.process(msg); err != nil {
 					l.err(err)
 				}
+			case <-l.resyncCh:
+				if err := l.resync(); err != nil {
+					l.err(err)
+				}
 			case <-l.ctx.Done():
 				l.shutdown()
 				return
@@ -144,7 +184,7 @@ func (l *Listener) Book() <-chan *exchange.BookUpdate {
 			return nil
 		}
 	}
-	bookCh := make(chan *exchange.BookUpdate, 1)
+	bookCh := make(chan *exchange.BookUpdate, l.opts.Buffer)
 	l.bookCh.Store(bookCh)
 	return bookCh
 }
@@ -162,17 +202,90 @@ func (l *Listener) Trades() <-chan []*exchange.Trade {
 			return nil
 		}
 	}
-	tradesCh := make(chan []*exchange.Trade, 1)
+	tradesCh := make(chan []*exchange.Trade, l.opts.Buffer)
 	l.tradesCh.Store(tradesCh)
 	return tradesCh
 }
 
+func (l *Listener) Orders() <-chan []*exchange.OrderUpdate {
+	if l.ctx == nil {
+		return nil
+	}
+	if ordersCh := l.ordersCh.Load(); ordersCh != nil && ordersCh.(chan []*exchange.OrderUpdate) != nil {
+		return ordersCh.(chan []*exchange.OrderUpdate)
+	}
+	if !l.subscribed.rawBook {
+		if err := l.subscribeRawBook(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	ordersCh := make(chan []*exchange.OrderUpdate, l.opts.Buffer)
+	l.ordersCh.Store(ordersCh)
+	return ordersCh
+}
+
+func (l *Listener) Ticker() <-chan *exchange.Ticker {
+	if l.ctx == nil {
+		return nil
+	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		return tickerCh.(chan *exchange.Ticker)
+	}
+	if !l.subscribed.ticker {
+		if err := l.subscribeTicker(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	tickerCh := make(chan *exchange.Ticker, l.opts.Buffer)
+	l.tickerCh.Store(tickerCh)
+	return tickerCh
+}
+
+func (l *Listener) Status() *exchange.Status {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	var subscriptions []string
+	if l.subscribed.book {
+		subscriptions = append(subscriptions, "book")
+	}
+	if l.subscribed.rawBook {
+		subscriptions = append(subscriptions, "rawBook")
+	}
+	if l.subscribed.trades {
+		subscriptions = append(subscriptions, "trades")
+	}
+	if l.subscribed.ticker {
+		subscriptions = append(subscriptions, "ticker")
+	}
+	return &exchange.Status{
+		Subscriptions: subscriptions,
+		Received:      timestamp.T(l.received.Load()),
+		Dropped:       l.counters.Dropped(),
+		Coalesced:     l.counters.Coalesced(),
+	}
+}
+
+// Resync makes books start over from snapshots.
+func (l *Listener) Resync() {
+	select {
+	case l.resyncCh <- struct{}{}:
+	default:
+	}
+}
+
 func (l *Listener) err(err error) {
-	l.opts.Stderr.Println("Error: bitfinex:", err)
+	l.log.Error().Msg(err.Error())
 }
 
-func (l *Listener) warn(err error) {
-	l.opts.Stderr.Println("Warning: bitfinex:", err)
+// disconnect stops the listener, its consumer not keeping up.
+func (l *Listener) disconnect() {
+	if l.ctx.Err() == nil {
+		l.log.Error().Msg("Channel full, disconnecting")
+		l.cancel()
+	}
 }
 
 func (l *Listener) sendWsMessage(msg string) error {
@@ -199,8 +312,8 @@ func (l *Listener) subscribeBook() error {
 	if l.subscribed.book {
 		return nil
 	}
-	msg := fmt.Sprintf(`{"event":"subscribe","channel":"book","symbol":"t%s","len":"250"}`,
-		strings.ToUpper(l.symbol))
+	msg := fmt.Sprintf(`{"event":"subscribe","channel":"book","symbol":"t%s","prec":"%s","freq":"%s","len":"%d"}`,
+		strings.ToUpper(l.symbol), l.opts.Precision, l.opts.Frequency, l.opts.Depth)
 	if err := l.sendWsMessage(msg); err != nil {
 		return err
 	}
@@ -227,6 +340,76 @@ func (l *Listener) unsubscribeBook() {
 	l.subscribed.book = false
 }
 
+func (l *Listener) subscribeRawBook() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.rawBook {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"event":"subscribe","channel":"book","symbol":"t%s","prec":"R0","len":"%d"}`,
+		strings.ToUpper(l.symbol), l.opts.Depth)
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.rawBook = true
+	return nil
+}
+
+func (l *Listener) unsubscribeRawBook() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.rawBook {
+		return
+	}
+	chanID := l.rawBook.chanID.Load()
+	if chanID == nil || chanID.(int64) == -1 {
+		return
+	}
+	msg := fmt.Sprintf(`{"event":"unsubscribe","chanId":%d}`, chanID.(int64))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.rawBook.chanID.Store(int64(-1))
+	l.subscribed.rawBook = false
+}
+
+func (l *Listener) subscribeTicker() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.ticker {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"event":"subscribe","channel":"ticker","symbol":"t%s"}`,
+		strings.ToUpper(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.ticker = true
+	return nil
+}
+
+func (l *Listener) unsubscribeTicker() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.ticker {
+		return
+	}
+	chanID := l.ticker.chanID.Load()
+	if chanID == nil || chanID.(int64) == -1 {
+		return
+	}
+	msg := fmt.Sprintf(`{"event":"unsubscribe","chanId":%d}`, chanID.(int64))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.ticker.chanID.Store(int64(-1))
+	l.subscribed.ticker = false
+}
+
 func (l *Listener) subscribeTrades() error {
 	l.subscribed.Lock()
 	defer l.subscribed.Unlock()
@@ -262,6 +445,30 @@ func (l *Listener) unsubscribeTrades() {
 	l.subscribed.trades = false
 }
 
+// resync resubscribes books, so that they start with snapshots again.
+func (l *Listener) resync() error {
+	l.subscribed.Lock()
+	book, rawBook := l.subscribed.book, l.subscribed.rawBook
+	l.subscribed.Unlock()
+	if book {
+		bookCh, _ := l.bookCh.Load().(chan *exchange.BookUpdate)
+		if !exchange.SendReset(bookCh, exchName, l.symbol, l.opts.Overflow, &l.counters) {
+			l.disconnect()
+		}
+		l.unsubscribeBook()
+		if err := l.subscribeBook(); err != nil {
+			return err
+		}
+	}
+	if rawBook {
+		l.unsubscribeRawBook()
+		if err := l.subscribeRawBook(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (l *Listener) process(msg []byte) error {
 	received := timestamp.Stamp(time.Now())
 	v, err := l.parser.ParseBytes(msg)
@@ -272,7 +479,7 @@ func (l *Listener) process(msg []byte) error {
 		n := len(arr)
 		seq, ts := arr[n-2].GetInt64(), timestamp.Milli(arr[n-1].GetInt64())
 		if seq != l.nextSeq && l.nextSeq != 0 {
-			l.err(fmt.Errorf("missing messages %d..%d", l.nextSeq, seq))
+			l.log.Error().Int64("chan_id", arr[0].GetInt64()).Int64("next_seq", l.nextSeq).Int64("seq", seq).Msg("Missing messages")
 		}
 		l.nextSeq = seq + 1
 
@@ -293,18 +500,44 @@ func (l *Listener) process(msg []byte) error {
 			l.sendBookUpdate(bu)
 			return nil
 		}
+		if id, ok := l.ticker.chanID.Load().(int64); ok && id == chanID {
+			tm := l.parseTicker(arr[1])
+			tm.Timestamp, tm.Received = ts, received
+			l.sendTicker(tm)
+			return nil
+		}
+		if id, ok := l.rawBook.chanID.Load().(int64); ok && id == chanID {
+			var ru *RawBookUpdateMessage
+			if l.rawBook.started {
+				ru = l.parseRawBookUpdate(arr[1])
+			} else {
+				ru = l.parseRawBookSnapshot(arr[1])
+				l.rawBook.started = true
+			}
+			ru.Timestamp, ru.Received = ts, received
+			l.sendOrders(ru)
+			return nil
+		}
 		if id, ok := l.trades.chanID.Load().(int64); ok && id == chanID {
 			var tu []*TradeMessage
 			if l.trades.started {
 				teu := arr[1].GetStringBytes()
-				if bytes.Equal(teu, []byte("te")) {
-					tu = l.parseTrade(arr[2])
-				} else if !bytes.Equal(teu, []byte("tu")) {
+				switch {
+				case bytes.Equal(teu, []byte("te")):
+					te := l.parseTrade(arr[2])
+					l.rememberTrades(te)
+					if !l.opts.FinalTrades {
+						tu = te
+					}
+				case bytes.Equal(teu, []byte("tu")):
+					tu = l.amendTrades(l.parseTrade(arr[2]))
+				default:
 					l.err(errors.New(string(msg)))
 					return nil
 				}
 			} else {
 				tu = l.parseTradeSnapshot(arr[1])
+				l.rememberTrades(tu)
 				l.trades.started = true
 			}
 			if len(tu) == 1 {
@@ -322,11 +555,19 @@ func (l *Listener) process(msg []byte) error {
 	event := v.GetStringBytes("event")
 	if bytes.Equal(event, []byte("subscribed")) {
 		channel := v.GetStringBytes("channel")
+		l.log.Debug().Bytes("channel", channel).Int64("chan_id", v.GetInt64("chanId")).Msg("Subscribed")
 		switch {
+		case bytes.Equal(channel, []byte("book")) && bytes.Equal(v.GetStringBytes("prec"), []byte("R0")):
+			l.rawBook.chanID.Store(v.GetInt64("chanId"))
+			l.rawBook.started = false
 		case bytes.Equal(channel, []byte("book")):
 			l.book.chanID.Store(v.GetInt64("chanId"))
+			l.book.started = false
 		case bytes.Equal(channel, []byte("trades")):
 			l.trades.chanID.Store(v.GetInt64("chanId"))
+			l.trades.started = false
+		case bytes.Equal(channel, []byte("ticker")):
+			l.ticker.chanID.Store(v.GetInt64("chanId"))
 		default:
 			return fmt.Errorf("subscribed unexpected channel %s", string(channel))
 		}
@@ -341,7 +582,7 @@ func (l *Listener) process(msg []byte) error {
 	if bytes.Contains(msg, []byte("error")) {
 		return errors.New(string(msg))
 	}
-	l.warn(errors.New(string(msg)))
+	l.log.Warn().RawJSON("msg", msg).Msg("Unexpected message")
 	return nil
 }
 
@@ -369,6 +610,7 @@ func (l *Listener) parseBookSnapshot(v *fastjson.Value) *BookUpdateMessage {
 	return &BookUpdateMessage{
 		Bids: bids,
 		Asks: asks,
+		Kind: exchange.Snapshot,
 	}
 }
 
@@ -423,13 +665,145 @@ func (l *Listener) sendBookUpdate(bu *BookUpdateMessage) {
 	if bookCh == nil || bookCh.(chan *exchange.BookUpdate) == nil {
 		return
 	}
-	bookCh.(chan *exchange.BookUpdate) <- &exchange.BookUpdate{
+	update := &exchange.BookUpdate{
 		Exchange:  exchName,
 		Symbol:    l.symbol,
 		Timestamp: bu.Timestamp,
 		Received:  bu.Received,
 		Bids:      bu.Bids,
 		Asks:      bu.Asks,
+		Kind:      bu.Kind,
+	}
+	if !exchange.SendBook(bookCh.(chan *exchange.BookUpdate), update, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *Listener) parseTicker(v *fastjson.Value) *TickerMessage {
+	bbo := v.GetArray()
+	if len(bbo) < 4 {
+		return &TickerMessage{}
+	}
+	return &TickerMessage{
+		BidPrice:    bbo[0].S(),
+		BidQuantity: bbo[1].S(),
+		AskPrice:    bbo[2].S(),
+		AskQuantity: bbo[3].S(),
+	}
+}
+
+func (l *Listener) sendTicker(tm *TickerMessage) {
+	tickerCh := l.tickerCh.Load()
+	if tickerCh == nil || tickerCh.(chan *exchange.Ticker) == nil {
+		return
+	}
+	ticker := &exchange.Ticker{
+		Exchange:    exchName,
+		Symbol:      l.symbol,
+		Timestamp:   tm.Timestamp,
+		Received:    tm.Received,
+		BidPrice:    tm.BidPrice,
+		BidQuantity: tm.BidQuantity,
+		AskPrice:    tm.AskPrice,
+		AskQuantity: tm.AskQuantity,
+	}
+	if !exchange.SendLatest(tickerCh.(chan *exchange.Ticker), ticker, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *Listener) parseRawBookSnapshot(v *fastjson.Value) *RawBookUpdateMessage {
+	var orders []RawOrder
+	if l.rawBook.orders != nil {
+		// Resubscribed or reconnected, orders deleted meanwhile never to be
+		// seen deleted, and those still there to be seen added again.
+		orders = append(orders, RawOrder{Action: exchange.OrderReset})
+	}
+	l.rawBook.orders = make(map[int64]string)
+	if opas := v.GetArray(); len(opas) > 0 {
+		for _, opa := range opas {
+			id, p, a := opa.GetArray()[0].GetInt64(), opa.GetArray()[1].S(), opa.GetArray()[2].S()
+			order := RawOrder{
+				OrderID: id,
+				Price:   p,
+				Amount:  a,
+				Bid:     a[0] != '-',
+				Action:  exchange.OrderAdd,
+			}
+			if !order.Bid {
+				order.Amount = a[1:]
+			}
+			l.rawBook.orders[id] = p
+			orders = append(orders, order)
+		}
+	}
+	return &RawBookUpdateMessage{
+		Orders: orders,
+	}
+}
+
+func (l *Listener) parseRawBookUpdate(v *fastjson.Value) *RawBookUpdateMessage {
+	var orders []RawOrder
+	if opa := v.GetArray(); opa != nil {
+		id, p, a := opa[0].GetInt64(), opa[1].S(), opa[2].S()
+		order := RawOrder{
+			OrderID: id,
+			Price:   p,
+			Amount:  a,
+			Bid:     a[0] != '-',
+		}
+		if !order.Bid {
+			order.Amount = a[1:]
+		}
+		if p == "0" {
+			// Remove order, its amount is 1 for bids and -1 for asks.
+			order.Price, order.Amount = l.rawBook.orders[id], "0"
+			order.Action = exchange.OrderDelete
+			delete(l.rawBook.orders, id)
+		} else {
+			if _, ok := l.rawBook.orders[id]; ok {
+				order.Action = exchange.OrderModify
+			} else {
+				order.Action = exchange.OrderAdd
+			}
+			l.rawBook.orders[id] = p
+		}
+		orders = []RawOrder{order}
+	}
+	return &RawBookUpdateMessage{
+		Orders: orders,
+	}
+}
+
+func (l *Listener) sendOrders(ru *RawBookUpdateMessage) {
+	ordersCh := l.ordersCh.Load()
+	if ordersCh == nil || ordersCh.(chan []*exchange.OrderUpdate) == nil {
+		return
+	}
+	if len(ru.Orders) == 0 {
+		return
+	}
+	oo := make([]*exchange.OrderUpdate, len(ru.Orders))
+	for i, order := range ru.Orders {
+		oo[i] = &exchange.OrderUpdate{
+			Exchange:  exchName,
+			Symbol:    l.symbol,
+			Timestamp: ru.Timestamp,
+			Received:  ru.Received,
+			OrderID:   order.OrderID,
+			Price:     order.Price,
+			Quantity:  order.Amount,
+			Action:    order.Action,
+			Side: func() exchange.Side {
+				if order.Bid {
+					return exchange.Bid
+				}
+				return exchange.Ask
+			}(),
+		}
+	}
+	if !exchange.SendOrders(ordersCh.(chan []*exchange.OrderUpdate), oo, l.opts.Overflow, &l.counters) {
+		l.disconnect()
 	}
 }
 
@@ -471,6 +845,44 @@ func (l *Listener) parseTrade(v *fastjson.Value) []*TradeMessage {
 	}
 }
 
+func (l *Listener) rememberTrades(trades []*TradeMessage) {
+	if l.trades.recent == nil {
+		l.trades.recent = make(map[int64]*TradeMessage, recentTrades)
+	}
+	for _, trade := range trades {
+		if _, ok := l.trades.recent[trade.TradeID]; !ok {
+			if len(l.trades.ids) == recentTrades {
+				delete(l.trades.recent, l.trades.ids[0])
+				l.trades.ids = append(l.trades.ids[:0], l.trades.ids[1:]...)
+			}
+			l.trades.ids = append(l.trades.ids, trade.TradeID)
+		}
+		l.trades.recent[trade.TradeID] = trade
+	}
+}
+
+// amendTrades compares final trade details from "tu" messages with what has
+// been sent on "te" already, returning trades to send. Those which differ are
+// sent again marked as amended, unless only final trades are to be sent.
+func (l *Listener) amendTrades(trades []*TradeMessage) []*TradeMessage {
+	var tu []*TradeMessage
+	for _, trade := range trades {
+		te, ok := l.trades.recent[trade.TradeID]
+		l.rememberTrades([]*TradeMessage{trade})
+		if l.opts.FinalTrades || !ok {
+			tu = append(tu, trade)
+			continue
+		}
+		if trade.Occurred == te.Occurred && trade.Price == te.Price &&
+			trade.Amount == te.Amount && trade.TakerBuy == te.TakerBuy {
+			continue
+		}
+		trade.Amended = true
+		tu = append(tu, trade)
+	}
+	return tu
+}
+
 func (l *Listener) sendTrades(trades []*TradeMessage) {
 	tradesCh := l.tradesCh.Load()
 	if tradesCh == nil || tradesCh.(chan []*exchange.Trade) == nil {
@@ -496,13 +908,16 @@ func (l *Listener) sendTrades(trades []*TradeMessage) {
 				}
 				return exchange.Sell
 			}(),
+			Amended: trade.Amended,
 		}
 	}
-	tradesCh.(chan []*exchange.Trade) <- tt
+	if !exchange.SendTrades(tradesCh.(chan []*exchange.Trade), tt, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
 }
 
 func (l *Listener) shutdown() {
-	l.opts.Stderr.Printf("Stopping listener bitfinex:%s", l.symbol)
+	l.log.Info().Msg("Stopping listener")
 	if bookCh := l.bookCh.Load(); bookCh != nil && bookCh.(chan *exchange.BookUpdate) != nil {
 		l.unsubscribeBook()
 		close(bookCh.(chan *exchange.BookUpdate))
@@ -513,6 +928,16 @@ func (l *Listener) shutdown() {
 		close(tradesCh.(chan []*exchange.Trade))
 		l.tradesCh.Store((chan []*exchange.Trade)(nil))
 	}
+	if ordersCh := l.ordersCh.Load(); ordersCh != nil && ordersCh.(chan []*exchange.OrderUpdate) != nil {
+		l.unsubscribeRawBook()
+		close(ordersCh.(chan []*exchange.OrderUpdate))
+		l.ordersCh.Store((chan []*exchange.OrderUpdate)(nil))
+	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		l.unsubscribeTicker()
+		close(tickerCh.(chan *exchange.Ticker))
+		l.tickerCh.Store((chan *exchange.Ticker)(nil))
+	}
 	l.ws.Close()
 	l.cancel()
 }
@@ -11,6 +11,23 @@ type BookUpdateMessage struct {
 
 	Bids []exchange.PriceLevelUpdate
 	Asks []exchange.PriceLevelUpdate
+
+	Kind exchange.UpdateKind // Snapshot, or delta by default.
+}
+
+type RawBookUpdateMessage struct {
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	Orders []RawOrder
+}
+
+type RawOrder struct {
+	OrderID int64
+	Price   string
+	Amount  string
+	Bid     bool
+	Action  exchange.OrderAction
 }
 
 type TradeMessage struct {
@@ -23,4 +40,16 @@ type TradeMessage struct {
 	Price    string
 	Amount   string
 	TakerBuy bool
+
+	Amended bool
+}
+
+type TickerMessage struct {
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	BidPrice    string
+	BidQuantity string
+	AskPrice    string
+	AskQuantity string
 }
@@ -17,6 +17,44 @@ type Listener interface {
 
 	Book() <-chan *BookUpdate
 	Trades() <-chan []*Trade
+
+	Status() *Status
+	Resync()
+}
+
+type TickerListener interface {
+	Listener
+
+	Ticker() <-chan *Ticker
+}
+
+type MarkPriceListener interface {
+	Listener
+
+	MarkPrice() <-chan *MarkPriceUpdate
+}
+
+type LiquidationListener interface {
+	Listener
+
+	Liquidations() <-chan []*Liquidation
+}
+
+type OrderListener interface {
+	Listener
+
+	Orders() <-chan []*OrderUpdate
+}
+
+//
+// Status
+
+type Status struct {
+	Subscriptions []string    // Channels subscribed to, as the exchange names them.
+	Received      timestamp.T // When the last message was received.
+
+	Dropped   int64 // Updates dropped for channels being full.
+	Coalesced int64 // Updates merged into later ones for channels being full.
 }
 
 //
@@ -44,13 +82,65 @@ type BookUpdate struct {
 
 	Bids []PriceLevelUpdate
 	Asks []PriceLevelUpdate
+
+	Kind UpdateKind
 }
 
+type UpdateKind int
+
+const (
+	Delta    UpdateKind = 0 // Levels changed, zero quantity ones removed.
+	Snapshot UpdateKind = 1 // Whole book, in place of whatever came before.
+	Reset    UpdateKind = 2 // Book to be cleared, a snapshot to follow.
+)
+
 type PriceLevelUpdate struct {
 	Price    string
 	Quantity string
 }
 
+//
+// Ticker
+
+type Ticker struct {
+	Exchange string
+	Symbol   string
+
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	BidPrice    string
+	BidQuantity string
+	AskPrice    string
+	AskQuantity string
+}
+
+//
+// Orders
+
+type OrderAction int
+
+const (
+	OrderAdd    OrderAction = 1
+	OrderModify OrderAction = 2
+	OrderDelete OrderAction = 3
+	OrderReset  OrderAction = 4 // All orders of the symbol are gone, a snapshot of them to follow.
+)
+
+type OrderUpdate struct {
+	Exchange string
+	Symbol   string
+
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	OrderID  int64
+	Side     Side
+	Price    string
+	Quantity string
+	Action   OrderAction
+}
+
 //
 // Trade
 
@@ -69,4 +159,43 @@ type Trade struct {
 	Price    string
 	Quantity string
 	Taker    Side
+
+	Amended bool // Corrects a trade sent before with the same id.
+}
+
+//
+// Mark price
+
+type MarkPriceUpdate struct {
+	Exchange string
+	Symbol   string
+
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	MarkPrice   string
+	IndexPrice  string
+	SettlePrice string
+
+	FundingRate string
+	FundingTime timestamp.T
+}
+
+//
+// Liquidation
+
+type Liquidation struct {
+	Exchange string
+	Symbol   string
+
+	Timestamp timestamp.T
+	Received  timestamp.T
+	Occurred  timestamp.T
+
+	Side     Side
+	Price    string
+	AvgPrice string
+	Quantity string
+	Filled   string
+	Status   string
 }
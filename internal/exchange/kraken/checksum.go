@@ -0,0 +1,93 @@
+package kraken
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// checksumBook keeps the top of the book as Kraken sees it, so that
+// checksums sent along with v2 book updates can be verified.
+type checksumBook struct {
+	depth int
+
+	bids []checksumLevel // Descending.
+	asks []checksumLevel // Ascending.
+
+	pricePrecision int
+	qtyPrecision   int
+}
+
+type checksumLevel struct {
+	price float64
+	qty   float64
+}
+
+func (b *checksumBook) reset() {
+	b.bids, b.asks = b.bids[:0], b.asks[:0]
+}
+
+func (b *checksumBook) apply(bids, asks []exchange.PriceLevelUpdate) {
+	for _, pl := range bids {
+		b.bids = b.update(b.bids, pl, func(a, b float64) bool { return a > b })
+	}
+	for _, pl := range asks {
+		b.asks = b.update(b.asks, pl, func(a, b float64) bool { return a < b })
+	}
+	if b.depth > 0 {
+		if len(b.bids) > b.depth {
+			b.bids = b.bids[:b.depth]
+		}
+		if len(b.asks) > b.depth {
+			b.asks = b.asks[:b.depth]
+		}
+	}
+}
+
+func (b *checksumBook) update(side []checksumLevel, pl exchange.PriceLevelUpdate, before func(a, b float64) bool) []checksumLevel {
+	price, err := strconv.ParseFloat(pl.Price, 64)
+	if err != nil {
+		return side
+	}
+	qty, err := strconv.ParseFloat(pl.Quantity, 64)
+	if err != nil {
+		return side
+	}
+	i := sort.Search(len(side), func(i int) bool { return !before(side[i].price, price) })
+	if i < len(side) && side[i].price == price {
+		if qty == 0 {
+			return append(side[:i], side[i+1:]...)
+		}
+		side[i].qty = qty
+		return side
+	}
+	if qty == 0 {
+		return side
+	}
+	side = append(side, checksumLevel{})
+	copy(side[i+1:], side[i:])
+	side[i] = checksumLevel{price: price, qty: qty}
+	return side
+}
+
+func (b *checksumBook) checksum() uint32 {
+	var s strings.Builder
+	for i := 0; i < len(b.asks) && i < 10; i++ {
+		s.WriteString(b.format(b.asks[i].price, b.pricePrecision))
+		s.WriteString(b.format(b.asks[i].qty, b.qtyPrecision))
+	}
+	for i := 0; i < len(b.bids) && i < 10; i++ {
+		s.WriteString(b.format(b.bids[i].price, b.pricePrecision))
+		s.WriteString(b.format(b.bids[i].qty, b.qtyPrecision))
+	}
+	return crc32.ChecksumIEEE([]byte(s.String()))
+}
+
+func (b *checksumBook) format(f float64, precision int) string {
+	s := strconv.FormatFloat(f, 'f', precision, 64)
+	s = strings.Replace(s, ".", "", 1)
+	return strings.TrimLeft(s, "0")
+}
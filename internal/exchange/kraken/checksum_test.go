@@ -0,0 +1,55 @@
+package kraken
+
+import (
+	"testing"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Example from Kraken's book checksum guide.
+func TestChecksum(t *testing.T) {
+	asks := []exchange.PriceLevelUpdate{
+		{Price: "0.05005", Quantity: "0.00000500"},
+		{Price: "0.05010", Quantity: "0.00000500"},
+		{Price: "0.05015", Quantity: "0.00000500"},
+		{Price: "0.05020", Quantity: "0.00000500"},
+		{Price: "0.05025", Quantity: "0.00000500"},
+		{Price: "0.05030", Quantity: "0.00000500"},
+		{Price: "0.05035", Quantity: "0.00000500"},
+		{Price: "0.05040", Quantity: "0.00000500"},
+		{Price: "0.05045", Quantity: "0.00000500"},
+		{Price: "0.05050", Quantity: "0.00000500"},
+	}
+	bids := []exchange.PriceLevelUpdate{
+		{Price: "0.05000", Quantity: "0.00000500"},
+		{Price: "0.04995", Quantity: "0.00000500"},
+		{Price: "0.04990", Quantity: "0.00000500"},
+		{Price: "0.04980", Quantity: "0.00000500"},
+		{Price: "0.04975", Quantity: "0.00000500"},
+		{Price: "0.04970", Quantity: "0.00000500"},
+		{Price: "0.04965", Quantity: "0.00000500"},
+		{Price: "0.04960", Quantity: "0.00000500"},
+		{Price: "0.04955", Quantity: "0.00000500"},
+		{Price: "0.04950", Quantity: "0.00000500"},
+	}
+	b := &checksumBook{depth: 10, pricePrecision: 5, qtyPrecision: 8}
+	b.apply(bids, asks)
+	if got, want := b.checksum(), uint32(974947235); got != want {
+		t.Errorf("checksum = %d, want %d", got, want)
+	}
+
+	// Levels beyond the top 10 don't count, and neither does the order
+	// updates come in.
+	b.reset()
+	b.apply(append([]exchange.PriceLevelUpdate{{Price: "0.04900", Quantity: "1.00000000"}}, bids[5:]...), asks[5:])
+	b.apply(bids[:5], asks[:5])
+	if got, want := b.checksum(), uint32(974947235); got != want {
+		t.Errorf("checksum out of order = %d, want %d", got, want)
+	}
+
+	// Deleted levels go.
+	b.apply([]exchange.PriceLevelUpdate{{Price: "0.05000", Quantity: "0"}}, nil)
+	if got := b.checksum(); got == 974947235 {
+		t.Errorf("checksum unchanged after deleting a level")
+	}
+}
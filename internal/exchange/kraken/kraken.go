@@ -1,9 +1,18 @@
 package kraken
 
-import "github.com/oerlikon/sounding/internal/common"
+import (
+	"github.com/rs/zerolog"
+
+	"github.com/oerlikon/sounding/internal/exchange"
+)
 
 const exchName = "Kraken"
 
 type Options struct {
-	Stderr common.Printlnfer
+	Logger zerolog.Logger
+
+	Buffer   int               // Book and trades channel capacity, 1 by default.
+	Overflow exchange.Overflow // What to do when they're full, block by default.
+
+	Depth int // Book depth, 10, 25, 100, 500 or 1000.
 }
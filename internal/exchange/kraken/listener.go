@@ -14,6 +14,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/oerlikon/fastjson"
 	"github.com/oerlikon/fastjson/fastfloat"
+	"github.com/rs/zerolog"
 
 	. "github.com/oerlikon/sounding/internal/common"
 	"github.com/oerlikon/sounding/internal/common/timestamp"
@@ -25,15 +26,20 @@ const serverURL = "wss://ws.kraken.com"
 type Listener struct {
 	symbol string
 	opts   Options
+	log    zerolog.Logger
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	bookCh   atomic.Value
 	tradesCh atomic.Value
+	tickerCh atomic.Value
 
-	ws     *websocket.Conn
-	parser fastjson.Parser
+	ws       *websocket.Conn
+	parser   fastjson.Parser
+	received atomic.Int64 // When the last message was received, as timestamp.T.
+	resyncCh chan struct{}
+	counters exchange.Counters
 
 	book struct {
 		channelName atomic.Value
@@ -44,10 +50,15 @@ type Listener struct {
 		channelName atomic.Value
 	}
 
+	spread struct {
+		channelName atomic.Value
+	}
+
 	subscribed struct {
 		sync.Mutex
-		book  bool
-		trade bool
+		book   bool
+		trade  bool
+		spread bool
 	}
 }
 
@@ -58,12 +69,17 @@ func NewListener(symbol string, options ...Option) exchange.Listener {
 			panic("kraken: error setting options: " + err.Error())
 		}
 	}
-	if opts.Stderr == nil {
-		opts.Stderr = Silent
+	if opts.Buffer == 0 {
+		opts.Buffer = 1
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 100
 	}
 	return &Listener{
-		symbol: symbol,
-		opts:   opts,
+		symbol:   symbol,
+		opts:     opts,
+		log:      opts.Logger.With().Str("exchange", exchName).Str("symbol", symbol).Logger(),
+		resyncCh: make(chan struct{}, 1),
 	}
 }
 
@@ -76,7 +92,7 @@ func (l *Listener) Symbol() string {
 }
 
 func (l *Listener) Start(ctx context.Context) error {
-	l.opts.Stderr.Printf("Starting listener kraken:%s", l.symbol)
+	l.log.Info().Msg("Starting listener")
 	ws, _, err := websocket.DefaultDialer.Dial(serverURL, nil)
 	if err != nil {
 		return err
@@ -113,9 +129,14 @@ func (l *Listener) Start(ctx context.Context) error {
 		for {
 			select {
 			case msg := <-msgs:
+				l.received.Store(int64(timestamp.Stamp(time.Now())))
 				if err := l.process(msg); err != nil {
 					l.err(err)
 				}
+			case <-l.resyncCh:
+				if err := l.resync(); err != nil {
+					l.err(err)
+				}
 			case <-l.ctx.Done():
 				l.shutdown()
 				return
@@ -138,7 +159,7 @@ func (l *Listener) Book() <-chan *exchange.BookUpdate {
 			return nil
 		}
 	}
-	bookCh := make(chan *exchange.BookUpdate, 1)
+	bookCh := make(chan *exchange.BookUpdate, l.opts.Buffer)
 	l.bookCh.Store(bookCh)
 	return bookCh
 }
@@ -156,17 +177,69 @@ func (l *Listener) Trades() <-chan []*exchange.Trade {
 			return nil
 		}
 	}
-	tradesCh := make(chan []*exchange.Trade, 1)
+	tradesCh := make(chan []*exchange.Trade, l.opts.Buffer)
 	l.tradesCh.Store(tradesCh)
 	return tradesCh
 }
 
+func (l *Listener) Ticker() <-chan *exchange.Ticker {
+	if l.ctx == nil {
+		return nil
+	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		return tickerCh.(chan *exchange.Ticker)
+	}
+	if !l.subscribed.spread {
+		if err := l.subscribeSpread(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	tickerCh := make(chan *exchange.Ticker, l.opts.Buffer)
+	l.tickerCh.Store(tickerCh)
+	return tickerCh
+}
+
+func (l *Listener) Status() *exchange.Status {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	var subscriptions []string
+	if l.subscribed.book {
+		subscriptions = append(subscriptions, "book")
+	}
+	if l.subscribed.trade {
+		subscriptions = append(subscriptions, "trade")
+	}
+	if l.subscribed.spread {
+		subscriptions = append(subscriptions, "spread")
+	}
+	return &exchange.Status{
+		Subscriptions: subscriptions,
+		Received:      timestamp.T(l.received.Load()),
+		Dropped:       l.counters.Dropped(),
+		Coalesced:     l.counters.Coalesced(),
+	}
+}
+
+// Resync makes books start over from snapshots.
+func (l *Listener) Resync() {
+	select {
+	case l.resyncCh <- struct{}{}:
+	default:
+	}
+}
+
 func (l *Listener) err(err error) {
-	l.opts.Stderr.Println("Error: kraken:", err)
+	l.log.Error().Msg(err.Error())
 }
 
-func (l *Listener) warn(err error) {
-	l.opts.Stderr.Println("Warning: kraken:", err)
+// disconnect stops the listener, its consumer not keeping up.
+func (l *Listener) disconnect() {
+	if l.ctx.Err() == nil {
+		l.log.Error().Msg("Channel full, disconnecting")
+		l.cancel()
+	}
 }
 
 func (l *Listener) sendWsMessage(msg string) error {
@@ -180,8 +253,8 @@ func (l *Listener) subscribeBook() error {
 	if l.subscribed.book {
 		return nil
 	}
-	msg := fmt.Sprintf(`{"event":"subscribe","pair":["%s"],"subscription":{"name":"book","depth":100}}`,
-		strings.ToUpper(l.symbol))
+	msg := fmt.Sprintf(`{"event":"subscribe","pair":["%s"],"subscription":{"name":"book","depth":%d}}`,
+		strings.ToUpper(l.symbol), l.opts.Depth)
 	if err := l.sendWsMessage(msg); err != nil {
 		return err
 	}
@@ -196,8 +269,8 @@ func (l *Listener) unsubscribeBook() {
 	if !l.subscribed.book {
 		return
 	}
-	msg := fmt.Sprintf(`{"event":"unsubscribe","pair":["%s"],"subscription":{"name":"book","depth":100}}`,
-		strings.ToUpper(l.symbol))
+	msg := fmt.Sprintf(`{"event":"unsubscribe","pair":["%s"],"subscription":{"name":"book","depth":%d}}`,
+		strings.ToUpper(l.symbol), l.opts.Depth)
 	if err := l.sendWsMessage(msg); err != nil {
 		return
 	}
@@ -237,6 +310,54 @@ func (l *Listener) unsubscribeTrade() {
 	l.subscribed.trade = false
 }
 
+func (l *Listener) subscribeSpread() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.spread {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"event":"subscribe","pair":["%s"],"subscription":{"name":"spread"}}`,
+		strings.ToUpper(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.spread = true
+	return nil
+}
+
+func (l *Listener) unsubscribeSpread() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.spread {
+		return
+	}
+	msg := fmt.Sprintf(`{"event":"unsubscribe","pair":["%s"],"subscription":{"name":"spread"}}`,
+		strings.ToUpper(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.spread.channelName.Store("")
+	l.subscribed.spread = false
+}
+
+// resync resubscribes book, so that it starts with a snapshot again.
+func (l *Listener) resync() error {
+	l.subscribed.Lock()
+	subscribed := l.subscribed.book
+	l.subscribed.Unlock()
+	if subscribed {
+		bookCh, _ := l.bookCh.Load().(chan *exchange.BookUpdate)
+		if !exchange.SendReset(bookCh, exchName, l.symbol, l.opts.Overflow, &l.counters) {
+			l.disconnect()
+		}
+		l.unsubscribeBook()
+		return l.subscribeBook()
+	}
+	return nil
+}
+
 func (l *Listener) process(msg []byte) error {
 	received := timestamp.Stamp(time.Now())
 	v, err := l.parser.ParseBytes(msg)
@@ -244,11 +365,12 @@ func (l *Listener) process(msg []byte) error {
 		return err
 	}
 	if arr, err := v.Array(); err == nil {
-		channelName := arr[2].S()
+		// Book updates carrying both asks and bids come as two separate objects.
+		channelName := arr[len(arr)-2].S()
 		if name, ok := l.book.channelName.Load().(string); ok && name == channelName {
 			var bu *BookUpdateMessage
 			if l.book.started {
-				bu = l.parseBookUpdate(arr[1])
+				bu = l.parseBookUpdate(arr[1 : len(arr)-2]...)
 			} else {
 				bu = l.parseBookSnapshot(arr[1])
 				l.book.started = true
@@ -265,6 +387,12 @@ func (l *Listener) process(msg []byte) error {
 			l.sendTrades(tu)
 			return nil
 		}
+		if name, ok := l.spread.channelName.Load().(string); ok && name == channelName {
+			tm := l.parseSpread(arr[1])
+			tm.Received = received
+			l.sendTicker(tm)
+			return nil
+		}
 		return nil
 	}
 	event := v.GetStringBytes("event")
@@ -273,11 +401,15 @@ func (l *Listener) process(msg []byte) error {
 		if bytes.Equal(status, []byte("subscribed")) {
 			channel := v.GetStringBytes("subscription", "name")
 			channelName := v.Get("channelName").S()
+			l.log.Debug().Str("channel", channelName).Int64("chan_id", v.GetInt64("channelID")).Msg("Subscribed")
 			switch {
 			case bytes.Equal(channel, []byte("book")):
 				l.book.channelName.Store(channelName)
+				l.book.started = false
 			case bytes.Equal(channel, []byte("trade")):
 				l.trade.channelName.Store(channelName)
+			case bytes.Equal(channel, []byte("spread")):
+				l.spread.channelName.Store(channelName)
 			default:
 				return fmt.Errorf("subscribed unexpected channel %s", channelName)
 			}
@@ -294,7 +426,7 @@ func (l *Listener) process(msg []byte) error {
 	if bytes.Contains(msg, []byte("error")) {
 		return errors.New(string(msg))
 	}
-	l.warn(errors.New(string(msg)))
+	l.log.Warn().RawJSON("msg", msg).Msg("Unexpected message")
 	return nil
 }
 
@@ -319,24 +451,29 @@ func (l *Listener) parseBookSnapshot(v *fastjson.Value) *BookUpdateMessage {
 	return &BookUpdateMessage{
 		Bids: bids,
 		Asks: asks,
+		Kind: exchange.Snapshot,
 	}
 }
 
-func (l *Listener) parseBookUpdate(v *fastjson.Value) *BookUpdateMessage {
+func (l *Listener) parseBookUpdate(vv ...*fastjson.Value) *BookUpdateMessage {
 	var bids, asks []exchange.PriceLevelUpdate
 
-	if b := v.GetArray("b"); b != nil {
-		bids = make([]exchange.PriceLevelUpdate, len(b))
-		for i, pq := range b {
-			bids[i].Price = pq.GetArray()[0].S()
-			bids[i].Quantity = pq.GetArray()[1].S()
+	for _, v := range vv {
+		if b := v.GetArray("b"); b != nil {
+			for _, pq := range b {
+				bids = append(bids, exchange.PriceLevelUpdate{
+					Price:    pq.GetArray()[0].S(),
+					Quantity: pq.GetArray()[1].S(),
+				})
+			}
 		}
-	}
-	if a := v.GetArray("a"); a != nil {
-		asks = make([]exchange.PriceLevelUpdate, len(a))
-		for i, pq := range a {
-			asks[i].Price = pq.GetArray()[0].S()
-			asks[i].Quantity = pq.GetArray()[1].S()
+		if a := v.GetArray("a"); a != nil {
+			for _, pq := range a {
+				asks = append(asks, exchange.PriceLevelUpdate{
+					Price:    pq.GetArray()[0].S(),
+					Quantity: pq.GetArray()[1].S(),
+				})
+			}
 		}
 	}
 
@@ -351,13 +488,17 @@ func (l *Listener) sendBookUpdate(bu *BookUpdateMessage) {
 	if bookCh == nil || bookCh.(chan *exchange.BookUpdate) == nil {
 		return
 	}
-	bookCh.(chan *exchange.BookUpdate) <- &exchange.BookUpdate{
+	update := &exchange.BookUpdate{
 		Exchange:  exchName,
 		Symbol:    l.symbol,
 		Timestamp: bu.Timestamp,
 		Received:  bu.Received,
 		Bids:      bu.Bids,
 		Asks:      bu.Asks,
+		Kind:      bu.Kind,
+	}
+	if !exchange.SendBook(bookCh.(chan *exchange.BookUpdate), update, l.opts.Overflow, &l.counters) {
+		l.disconnect()
 	}
 }
 
@@ -408,11 +549,47 @@ func (l *Listener) sendTrades(trades []*TradeMessage) {
 			Taker:     trade.Taker,
 		}
 	}
-	tradesCh.(chan []*exchange.Trade) <- tt
+	if !exchange.SendTrades(tradesCh.(chan []*exchange.Trade), tt, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *Listener) parseSpread(v *fastjson.Value) *TickerMessage {
+	bats := v.GetArray()
+	if len(bats) < 5 {
+		return &TickerMessage{}
+	}
+	return &TickerMessage{
+		Timestamp:   timestamp.Float(fastfloat.ParseBestEffort(bats[2].S())),
+		BidPrice:    bats[0].S(),
+		BidQuantity: bats[3].S(),
+		AskPrice:    bats[1].S(),
+		AskQuantity: bats[4].S(),
+	}
+}
+
+func (l *Listener) sendTicker(tm *TickerMessage) {
+	tickerCh := l.tickerCh.Load()
+	if tickerCh == nil || tickerCh.(chan *exchange.Ticker) == nil {
+		return
+	}
+	ticker := &exchange.Ticker{
+		Exchange:    exchName,
+		Symbol:      l.symbol,
+		Timestamp:   tm.Timestamp,
+		Received:    tm.Received,
+		BidPrice:    tm.BidPrice,
+		BidQuantity: tm.BidQuantity,
+		AskPrice:    tm.AskPrice,
+		AskQuantity: tm.AskQuantity,
+	}
+	if !exchange.SendLatest(tickerCh.(chan *exchange.Ticker), ticker, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
 }
 
 func (l *Listener) shutdown() {
-	l.opts.Stderr.Printf("Stopping listener kraken:%s", l.symbol)
+	l.log.Info().Msg("Stopping listener")
 	if bookCh := l.bookCh.Load(); bookCh != nil && bookCh.(chan *exchange.BookUpdate) != nil {
 		l.unsubscribeBook()
 		close(bookCh.(chan *exchange.BookUpdate))
@@ -423,6 +600,11 @@ func (l *Listener) shutdown() {
 		close(tradesCh.(chan []*exchange.Trade))
 		l.tradesCh.Store((chan []*exchange.Trade)(nil))
 	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		l.unsubscribeSpread()
+		close(tickerCh.(chan *exchange.Ticker))
+		l.tickerCh.Store((chan *exchange.Ticker)(nil))
+	}
 	l.ws.Close()
 	l.cancel()
 }
@@ -0,0 +1,656 @@
+package kraken
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/oerlikon/fastjson"
+	"github.com/rs/zerolog"
+
+	. "github.com/oerlikon/sounding/internal/common"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+const serverURLv2 = "wss://ws.kraken.com/v2"
+
+type ListenerV2 struct {
+	symbol string
+	opts   Options
+	log    zerolog.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	bookCh   atomic.Value
+	tradesCh atomic.Value
+	tickerCh atomic.Value
+
+	ws       *websocket.Conn
+	parser   fastjson.Parser
+	received atomic.Int64 // When the last message was received, as timestamp.T.
+	resyncCh chan struct{}
+	counters exchange.Counters
+
+	book struct {
+		synced    bool
+		precision bool
+		checksum  checksumBook
+	}
+
+	subscribed struct {
+		sync.Mutex
+		book       bool
+		trade      bool
+		ticker     bool
+		instrument bool
+	}
+}
+
+func NewListenerV2(symbol string, options ...Option) exchange.Listener {
+	var opts Options
+	for _, opt := range options {
+		if err := opt(&opts); err != nil {
+			panic("kraken: error setting options: " + err.Error())
+		}
+	}
+	if opts.Buffer == 0 {
+		opts.Buffer = 1
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 100
+	}
+	l := &ListenerV2{
+		symbol:   symbol,
+		opts:     opts,
+		log:      opts.Logger.With().Str("exchange", exchName).Str("symbol", symbol).Str("api", "v2").Logger(),
+		resyncCh: make(chan struct{}, 1),
+	}
+	l.book.checksum.depth = opts.Depth
+	return l
+}
+
+func (l *ListenerV2) Exchange() string {
+	return exchName
+}
+
+func (l *ListenerV2) Symbol() string {
+	return l.symbol
+}
+
+func (l *ListenerV2) Start(ctx context.Context) error {
+	l.log.Info().Msg("Starting listener")
+	ws, _, err := websocket.DefaultDialer.Dial(serverURLv2, nil)
+	if err != nil {
+		return err
+	}
+	l.ws = ws
+
+	l.ctx, l.cancel = context.WithCancel(ctx)
+
+	msgs := make(chan []byte, 1)
+	go func() {
+		errcount := 0
+		for {
+			if l.ctx.Err() != nil {
+				return
+			}
+			_, msg, err := l.ws.ReadMessage()
+			if err == nil {
+				if len(msg) > 0 {
+					msgs <- msg
+				}
+				errcount = 0
+				continue
+			}
+			if errors.Is(err, net.ErrClosed) && l.ctx.Err() != nil {
+				return
+			}
+			l.err(err)
+			if errcount++; errcount == 5 {
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case msg := <-msgs:
+				l.received.Store(int64(timestamp.Stamp(time.Now())))
+				if err := l.process(msg); err != nil {
+					l.err(err)
+				}
+			case <-l.resyncCh:
+				if err := l.resync(); err != nil {
+					l.err(err)
+				}
+			case <-l.ctx.Done():
+				l.shutdown()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (l *ListenerV2) Book() <-chan *exchange.BookUpdate {
+	if l.ctx == nil {
+		return nil
+	}
+	if bookCh := l.bookCh.Load(); bookCh != nil && bookCh.(chan *exchange.BookUpdate) != nil {
+		return bookCh.(chan *exchange.BookUpdate)
+	}
+	if !l.subscribed.instrument {
+		if err := l.subscribeInstrument(); err != nil {
+			l.warn(err)
+		}
+	}
+	if !l.subscribed.book {
+		if err := l.subscribeBook(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	bookCh := make(chan *exchange.BookUpdate, l.opts.Buffer)
+	l.bookCh.Store(bookCh)
+	return bookCh
+}
+
+func (l *ListenerV2) Trades() <-chan []*exchange.Trade {
+	if l.ctx == nil {
+		return nil
+	}
+	if tradesCh := l.tradesCh.Load(); tradesCh != nil && tradesCh.(chan []*exchange.Trade) != nil {
+		return tradesCh.(chan []*exchange.Trade)
+	}
+	if !l.subscribed.trade {
+		if err := l.subscribeTrade(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	tradesCh := make(chan []*exchange.Trade, l.opts.Buffer)
+	l.tradesCh.Store(tradesCh)
+	return tradesCh
+}
+
+func (l *ListenerV2) Ticker() <-chan *exchange.Ticker {
+	if l.ctx == nil {
+		return nil
+	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		return tickerCh.(chan *exchange.Ticker)
+	}
+	if !l.subscribed.ticker {
+		if err := l.subscribeTicker(); err != nil {
+			l.err(err)
+			return nil
+		}
+	}
+	tickerCh := make(chan *exchange.Ticker, l.opts.Buffer)
+	l.tickerCh.Store(tickerCh)
+	return tickerCh
+}
+
+func (l *ListenerV2) Status() *exchange.Status {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	var subscriptions []string
+	if l.subscribed.instrument {
+		subscriptions = append(subscriptions, "instrument")
+	}
+	if l.subscribed.book {
+		subscriptions = append(subscriptions, "book")
+	}
+	if l.subscribed.trade {
+		subscriptions = append(subscriptions, "trade")
+	}
+	if l.subscribed.ticker {
+		subscriptions = append(subscriptions, "ticker")
+	}
+	return &exchange.Status{
+		Subscriptions: subscriptions,
+		Received:      timestamp.T(l.received.Load()),
+		Dropped:       l.counters.Dropped(),
+		Coalesced:     l.counters.Coalesced(),
+	}
+}
+
+// Resync makes books start over from snapshots.
+func (l *ListenerV2) Resync() {
+	select {
+	case l.resyncCh <- struct{}{}:
+	default:
+	}
+}
+
+func (l *ListenerV2) err(err error) {
+	l.log.Error().Msg(err.Error())
+}
+
+// disconnect stops the listener, its consumer not keeping up.
+func (l *ListenerV2) disconnect() {
+	if l.ctx.Err() == nil {
+		l.log.Error().Msg("Channel full, disconnecting")
+		l.cancel()
+	}
+}
+
+func (l *ListenerV2) warn(err error) {
+	l.log.Warn().Msg(err.Error())
+}
+
+func (l *ListenerV2) sendWsMessage(msg string) error {
+	return l.ws.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+func (l *ListenerV2) subscribeInstrument() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.instrument {
+		return nil
+	}
+	msg := `{"method":"subscribe","params":{"channel":"instrument","snapshot":true},"req_id":3}`
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.instrument = true
+	return nil
+}
+
+func (l *ListenerV2) unsubscribeInstrument() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.instrument {
+		return
+	}
+	msg := `{"method":"unsubscribe","params":{"channel":"instrument"},"req_id":3}`
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.subscribed.instrument = false
+}
+
+func (l *ListenerV2) subscribeBook() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.book {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"method":"subscribe","params":{"channel":"book","symbol":["%s"],"depth":%d,"snapshot":true},"req_id":1}`,
+		strings.ToUpper(l.symbol), l.opts.Depth)
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.book = true
+	return nil
+}
+
+func (l *ListenerV2) unsubscribeBook() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.book {
+		return
+	}
+	msg := fmt.Sprintf(`{"method":"unsubscribe","params":{"channel":"book","symbol":["%s"],"depth":%d},"req_id":1}`,
+		strings.ToUpper(l.symbol), l.opts.Depth)
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.book.synced = false
+	l.subscribed.book = false
+}
+
+func (l *ListenerV2) subscribeTrade() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.trade {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"method":"subscribe","params":{"channel":"trade","symbol":["%s"],"snapshot":false},"req_id":2}`,
+		strings.ToUpper(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.trade = true
+	return nil
+}
+
+func (l *ListenerV2) unsubscribeTrade() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.trade {
+		return
+	}
+	msg := fmt.Sprintf(`{"method":"unsubscribe","params":{"channel":"trade","symbol":["%s"]},"req_id":2}`,
+		strings.ToUpper(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.subscribed.trade = false
+}
+
+func (l *ListenerV2) subscribeTicker() error {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if l.subscribed.ticker {
+		return nil
+	}
+	msg := fmt.Sprintf(`{"method":"subscribe","params":{"channel":"ticker","symbol":["%s"],"event_trigger":"bbo"},"req_id":4}`,
+		strings.ToUpper(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return err
+	}
+	l.subscribed.ticker = true
+	return nil
+}
+
+func (l *ListenerV2) unsubscribeTicker() {
+	l.subscribed.Lock()
+	defer l.subscribed.Unlock()
+
+	if !l.subscribed.ticker {
+		return
+	}
+	msg := fmt.Sprintf(`{"method":"unsubscribe","params":{"channel":"ticker","symbol":["%s"],"event_trigger":"bbo"},"req_id":4}`,
+		strings.ToUpper(l.symbol))
+	if err := l.sendWsMessage(msg); err != nil {
+		return
+	}
+	l.subscribed.ticker = false
+}
+
+// resync resubscribes book, so that it starts with a snapshot again.
+func (l *ListenerV2) resync() error {
+	l.subscribed.Lock()
+	subscribed := l.subscribed.book
+	l.subscribed.Unlock()
+	if subscribed {
+		return l.resubscribeBook()
+	}
+	return nil
+}
+
+func (l *ListenerV2) resubscribeBook() error {
+	bookCh, _ := l.bookCh.Load().(chan *exchange.BookUpdate)
+	if !exchange.SendReset(bookCh, exchName, l.symbol, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+	l.unsubscribeBook()
+	return l.subscribeBook()
+}
+
+func (l *ListenerV2) process(msg []byte) error {
+	received := timestamp.Stamp(time.Now())
+	v, err := l.parser.ParseBytes(msg)
+	if err != nil {
+		return err
+	}
+	channel := v.GetStringBytes("channel")
+	switch {
+	case bytes.Equal(channel, []byte("book")):
+		snapshot := bytes.Equal(v.GetStringBytes("type"), []byte("snapshot"))
+		for _, data := range v.GetArray("data") {
+			if !strings.EqualFold(string(data.GetStringBytes("symbol")), l.symbol) {
+				continue
+			}
+			if snapshot {
+				l.book.checksum.reset()
+				l.book.synced = true
+			} else if !l.book.synced {
+				continue
+			}
+			bu := l.parseBookUpdate(data)
+			if snapshot {
+				bu.Kind = exchange.Snapshot
+			}
+			if bu.Timestamp == 0 {
+				bu.Timestamp = received
+			}
+			bu.Received = received
+			l.book.checksum.apply(bu.Bids, bu.Asks)
+			if l.book.precision {
+				if checksum := l.book.checksum.checksum(); checksum != bu.Checksum {
+					l.log.Warn().Uint32("checksum", checksum).Uint32("expected", bu.Checksum).Msg("Book checksum mismatch, resubscribing")
+					if err := l.resubscribeBook(); err != nil {
+						return err
+					}
+					continue // Not to be applied, the book starting over.
+				}
+			}
+			l.sendBookUpdate(bu)
+		}
+		return nil
+	case bytes.Equal(channel, []byte("trade")):
+		var tu []*TradeMessage
+		for _, data := range v.GetArray("data") {
+			if !strings.EqualFold(string(data.GetStringBytes("symbol")), l.symbol) {
+				continue
+			}
+			trade, err := l.parseTrade(data)
+			if err != nil {
+				return err
+			}
+			trade.Timestamp, trade.Received = received, received
+			tu = append(tu, trade)
+		}
+		l.sendTrades(tu)
+		return nil
+	case bytes.Equal(channel, []byte("ticker")):
+		for _, data := range v.GetArray("data") {
+			if !strings.EqualFold(string(data.GetStringBytes("symbol")), l.symbol) {
+				continue
+			}
+			tm := l.parseTicker(data)
+			if tm.Timestamp == 0 {
+				tm.Timestamp = received
+			}
+			tm.Received = received
+			l.sendTicker(tm)
+		}
+		return nil
+	case bytes.Equal(channel, []byte("instrument")):
+		for _, pair := range v.GetArray("data", "pairs") {
+			if !strings.EqualFold(string(pair.GetStringBytes("symbol")), l.symbol) {
+				continue
+			}
+			l.book.checksum.pricePrecision = pair.GetInt("price_precision")
+			l.book.checksum.qtyPrecision = pair.GetInt("qty_precision")
+			l.book.precision = true
+			l.unsubscribeInstrument()
+		}
+		return nil
+	case bytes.Equal(channel, []byte("heartbeat")):
+		return nil
+	case bytes.Equal(channel, []byte("status")):
+		return nil
+	}
+	if method := v.GetStringBytes("method"); method != nil {
+		if v.GetBool("success") {
+			l.log.Debug().Bytes("method", method).Bytes("channel", v.GetStringBytes("result", "channel")).Msg("Succeeded")
+			return nil
+		}
+		return errors.New(string(msg))
+	}
+	if bytes.Contains(msg, []byte("error")) {
+		return errors.New(string(msg))
+	}
+	l.log.Warn().RawJSON("msg", msg).Msg("Unexpected message")
+	return nil
+}
+
+func (l *ListenerV2) parseBookUpdate(v *fastjson.Value) *BookUpdateMessage {
+	var bids, asks []exchange.PriceLevelUpdate
+
+	if b := v.GetArray("bids"); b != nil {
+		bids = make([]exchange.PriceLevelUpdate, len(b))
+		for i, pq := range b {
+			bids[i].Price = pq.Get("price").S()
+			bids[i].Quantity = pq.Get("qty").S()
+		}
+	}
+	if a := v.GetArray("asks"); a != nil {
+		asks = make([]exchange.PriceLevelUpdate, len(a))
+		for i, pq := range a {
+			asks[i].Price = pq.Get("price").S()
+			asks[i].Quantity = pq.Get("qty").S()
+		}
+	}
+
+	var ts timestamp.T
+	if s := v.GetStringBytes("timestamp"); s != nil {
+		if t, err := time.Parse(time.RFC3339Nano, string(s)); err == nil {
+			ts = timestamp.Stamp(t)
+		}
+	}
+
+	return &BookUpdateMessage{
+		Timestamp: ts,
+		Bids:      bids,
+		Asks:      asks,
+		Checksum:  uint32(v.GetUint("checksum")),
+	}
+}
+
+func (l *ListenerV2) sendBookUpdate(bu *BookUpdateMessage) {
+	bookCh := l.bookCh.Load()
+	if bookCh == nil || bookCh.(chan *exchange.BookUpdate) == nil {
+		return
+	}
+	update := &exchange.BookUpdate{
+		Exchange:  exchName,
+		Symbol:    l.symbol,
+		Timestamp: bu.Timestamp,
+		Received:  bu.Received,
+		Bids:      bu.Bids,
+		Asks:      bu.Asks,
+		Kind:      bu.Kind,
+	}
+	if !exchange.SendBook(bookCh.(chan *exchange.BookUpdate), update, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *ListenerV2) parseTrade(v *fastjson.Value) (*TradeMessage, error) {
+	var taker exchange.Side
+	switch s := string(v.GetStringBytes("side")); s {
+	case "buy":
+		taker = exchange.Buy
+	case "sell":
+		taker = exchange.Sell
+	default:
+		return nil, fmt.Errorf("unexpected taker '%s'", s)
+	}
+	var occurred timestamp.T
+	if t, err := time.Parse(time.RFC3339Nano, string(v.GetStringBytes("timestamp"))); err == nil {
+		occurred = timestamp.Stamp(t)
+	}
+	return &TradeMessage{
+		Occurred: occurred,
+		TradeID:  v.GetInt64("trade_id"),
+		Price:    v.Get("price").S(),
+		Volume:   v.Get("qty").S(),
+		Taker:    taker,
+	}, nil
+}
+
+func (l *ListenerV2) sendTrades(trades []*TradeMessage) {
+	tradesCh := l.tradesCh.Load()
+	if tradesCh == nil || tradesCh.(chan []*exchange.Trade) == nil {
+		return
+	}
+	if len(trades) == 0 {
+		return
+	}
+	tt := make([]*exchange.Trade, len(trades))
+	for i, trade := range trades {
+		tt[i] = &exchange.Trade{
+			Exchange:  exchName,
+			Symbol:    l.symbol,
+			Timestamp: trade.Timestamp,
+			Received:  trade.Received,
+			Occurred:  trade.Occurred,
+			TradeID:   trade.TradeID,
+			Price:     trade.Price,
+			Quantity:  trade.Volume,
+			Taker:     trade.Taker,
+		}
+	}
+	if !exchange.SendTrades(tradesCh.(chan []*exchange.Trade), tt, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *ListenerV2) parseTicker(v *fastjson.Value) *TickerMessage {
+	var ts timestamp.T
+	if s := v.GetStringBytes("timestamp"); s != nil {
+		if t, err := time.Parse(time.RFC3339Nano, string(s)); err == nil {
+			ts = timestamp.Stamp(t)
+		}
+	}
+	return &TickerMessage{
+		Timestamp:   ts,
+		BidPrice:    v.Get("bid").S(),
+		BidQuantity: v.Get("bid_qty").S(),
+		AskPrice:    v.Get("ask").S(),
+		AskQuantity: v.Get("ask_qty").S(),
+	}
+}
+
+func (l *ListenerV2) sendTicker(tm *TickerMessage) {
+	tickerCh := l.tickerCh.Load()
+	if tickerCh == nil || tickerCh.(chan *exchange.Ticker) == nil {
+		return
+	}
+	ticker := &exchange.Ticker{
+		Exchange:    exchName,
+		Symbol:      l.symbol,
+		Timestamp:   tm.Timestamp,
+		Received:    tm.Received,
+		BidPrice:    tm.BidPrice,
+		BidQuantity: tm.BidQuantity,
+		AskPrice:    tm.AskPrice,
+		AskQuantity: tm.AskQuantity,
+	}
+	if !exchange.SendLatest(tickerCh.(chan *exchange.Ticker), ticker, l.opts.Overflow, &l.counters) {
+		l.disconnect()
+	}
+}
+
+func (l *ListenerV2) shutdown() {
+	l.log.Info().Msg("Stopping listener")
+	if bookCh := l.bookCh.Load(); bookCh != nil && bookCh.(chan *exchange.BookUpdate) != nil {
+		l.unsubscribeBook()
+		close(bookCh.(chan *exchange.BookUpdate))
+		l.bookCh.Store((chan *exchange.BookUpdate)(nil))
+	}
+	if tradesCh := l.tradesCh.Load(); tradesCh != nil && tradesCh.(chan []*exchange.Trade) != nil {
+		l.unsubscribeTrade()
+		close(tradesCh.(chan []*exchange.Trade))
+		l.tradesCh.Store((chan []*exchange.Trade)(nil))
+	}
+	if tickerCh := l.tickerCh.Load(); tickerCh != nil && tickerCh.(chan *exchange.Ticker) != nil {
+		l.unsubscribeTicker()
+		close(tickerCh.(chan *exchange.Ticker))
+		l.tickerCh.Store((chan *exchange.Ticker)(nil))
+	}
+	l.unsubscribeInstrument()
+	l.ws.Close()
+	l.cancel()
+}
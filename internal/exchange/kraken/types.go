@@ -11,6 +11,10 @@ type BookUpdateMessage struct {
 
 	Bids []exchange.PriceLevelUpdate
 	Asks []exchange.PriceLevelUpdate
+
+	Checksum uint32
+
+	Kind exchange.UpdateKind // Snapshot, or delta by default.
 }
 
 type TradeMessage struct {
@@ -18,7 +22,19 @@ type TradeMessage struct {
 	Received  timestamp.T
 	Occurred  timestamp.T
 
+	TradeID int64
+
 	Price  string
 	Volume string
 	Taker  exchange.Side
 }
+
+type TickerMessage struct {
+	Timestamp timestamp.T
+	Received  timestamp.T
+
+	BidPrice    string
+	BidQuantity string
+	AskPrice    string
+	AskQuantity string
+}
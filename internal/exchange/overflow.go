@@ -0,0 +1,225 @@
+package exchange
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+)
+
+// Overflow tells what a listener does with an update when the channel it's
+// to be sent to is full.
+type Overflow int
+
+const (
+	Block      Overflow = iota // Wait for room, holding up reading from the exchange.
+	DropOldest                 // Drop the oldest update buffered to make room, coalescing book and order updates instead.
+	Coalesce                   // Merge updates buffered into one, book levels by price, trades into one batch.
+	Disconnect                 // Stop the listener, closing its channels.
+)
+
+var overflows = []string{"block", "drop-oldest", "coalesce", "disconnect"}
+
+func ParseOverflow(s string) (Overflow, error) {
+	for i, name := range overflows {
+		if s == name {
+			return Overflow(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown overflow policy: %s", s)
+}
+
+func (o Overflow) String() string {
+	if o < 0 || int(o) >= len(overflows) {
+		return fmt.Sprintf("Overflow(%d)", o)
+	}
+	return overflows[o]
+}
+
+// Counters count updates that didn't get through as they were for channels
+// being full.
+type Counters struct {
+	dropped   atomic.Int64
+	coalesced atomic.Int64
+}
+
+func (c *Counters) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+func (c *Counters) Coalesced() int64 {
+	return c.coalesced.Load()
+}
+
+// SendBook sends bu to ch, doing as overflow says if ch is full. Returns false
+// if the listener is to disconnect, bu not having been sent.
+func SendBook(ch chan *BookUpdate, bu *BookUpdate, overflow Overflow, counters *Counters) bool {
+	if overflow == DropOldest {
+		overflow = Coalesce // Dropping any would leave the book wrong.
+	}
+	return send(ch, bu, overflow, counters, mergeBook)
+}
+
+// SendReset sends to ch a reset of the book of exchange and symbol, telling
+// it's to be cleared, a snapshot to follow, doing as overflow says if ch is
+// full. Returns false if the listener is to disconnect. Nil ch is left be.
+func SendReset(ch chan *BookUpdate, exch, symbol string, overflow Overflow, counters *Counters) bool {
+	if ch == nil {
+		return true
+	}
+	now := timestamp.Stamp(time.Now())
+	return SendBook(ch, &BookUpdate{
+		Exchange:  exch,
+		Symbol:    symbol,
+		Timestamp: now,
+		Received:  now,
+		Kind:      Reset,
+	}, overflow, counters)
+}
+
+// SendTrades sends trades to ch, doing as overflow says if ch is full. Returns
+// false if the listener is to disconnect, trades not having been sent.
+func SendTrades(ch chan []*Trade, trades []*Trade, overflow Overflow, counters *Counters) bool {
+	return send(ch, trades, overflow, counters, func(a, b []*Trade) []*Trade {
+		return append(a[:len(a):len(a)], b...)
+	})
+}
+
+// SendOrders sends order updates to ch, doing as overflow says if ch is full.
+// Returns false if the listener is to disconnect, orders not having been sent.
+func SendOrders(ch chan []*OrderUpdate, orders []*OrderUpdate, overflow Overflow, counters *Counters) bool {
+	if overflow == DropOldest {
+		overflow = Coalesce // Dropping any would leave the book wrong.
+	}
+	return send(ch, orders, overflow, counters, func(a, b []*OrderUpdate) []*OrderUpdate {
+		return append(a[:len(a):len(a)], b...)
+	})
+}
+
+// SendLiquidations sends liquidations to ch, doing as overflow says if ch is
+// full. Returns false if the listener is to disconnect, liquidations not having
+// been sent.
+func SendLiquidations(ch chan []*Liquidation, liquidations []*Liquidation, overflow Overflow, counters *Counters) bool {
+	return send(ch, liquidations, overflow, counters, func(a, b []*Liquidation) []*Liquidation {
+		return append(a[:len(a):len(a)], b...)
+	})
+}
+
+// SendLatest sends v to ch, doing as overflow says if ch is full, coalescing
+// keeping the latest update only. Returns false if the listener is to
+// disconnect, v not having been sent. For tickers and mark prices, telling state
+// rather than events.
+func SendLatest[T any](ch chan T, v T, overflow Overflow, counters *Counters) bool {
+	return send(ch, v, overflow, counters, func(_, b T) T { return b })
+}
+
+// send sends v to ch, the caller being the only sender. Updates taken out of
+// ch to make room get merged with merge, older first, if coalescing.
+func send[T any](ch chan T, v T, overflow Overflow, counters *Counters, merge func(a, b T) T) bool {
+	select {
+	case ch <- v:
+		return true
+	default:
+	}
+	switch overflow {
+	case DropOldest:
+		for {
+			select {
+			case <-ch:
+				counters.dropped.Add(1)
+			default:
+			}
+			select {
+			case ch <- v:
+				return true
+			default:
+			}
+		}
+	case Coalesce:
+		var merged T
+		n := 0
+	drain:
+		for {
+			select {
+			case u := <-ch:
+				if n == 0 {
+					merged = u
+				} else {
+					merged = merge(merged, u)
+				}
+				n++
+			default:
+				break drain
+			}
+		}
+		if n > 0 {
+			v = merge(merged, v)
+			counters.coalesced.Add(int64(n))
+		}
+		ch <- v // There's room now, nothing else sending.
+		return true
+	case Disconnect:
+		counters.dropped.Add(1)
+		return false
+	}
+	ch <- v
+	return true
+}
+
+// mergeBook merges book updates a and b, levels of b taking place of those of
+// a at the same price. Snapshot or reset b takes place of a altogether. Merged
+// into a snapshot, levels removed are left out, and a reset stays bare, its
+// snapshot to follow.
+func mergeBook(a, b *BookUpdate) *BookUpdate {
+	if b.Kind != Delta {
+		return b
+	}
+	merged := &BookUpdate{
+		Exchange:  b.Exchange,
+		Symbol:    b.Symbol,
+		Timestamp: b.Timestamp,
+		Received:  b.Received,
+		Kind:      a.Kind,
+	}
+	switch a.Kind {
+	case Delta:
+		merged.Bids = mergeLevels(a.Bids, b.Bids)
+		merged.Asks = mergeLevels(a.Asks, b.Asks)
+	case Snapshot:
+		merged.Bids = removeEmpty(mergeLevels(a.Bids, b.Bids))
+		merged.Asks = removeEmpty(mergeLevels(a.Asks, b.Asks))
+	}
+	return merged
+}
+
+func mergeLevels(a, b []PriceLevelUpdate) []PriceLevelUpdate {
+	if len(a) == 0 {
+		return b
+	}
+	merged := make([]PriceLevelUpdate, 0, len(a)+len(b))
+	at := make(map[string]int, len(a)+len(b))
+	for _, ll := range [][]PriceLevelUpdate{a, b} {
+		for _, pl := range ll {
+			if i, ok := at[pl.Price]; ok {
+				merged[i] = pl
+				continue
+			}
+			at[pl.Price] = len(merged)
+			merged = append(merged, pl)
+		}
+	}
+	return merged
+}
+
+// removeEmpty removes levels with zero quantity.
+func removeEmpty(levels []PriceLevelUpdate) []PriceLevelUpdate {
+	kept := levels[:0:0]
+	for _, pl := range levels {
+		if q, err := strconv.ParseFloat(pl.Quantity, 64); err != nil || q != 0 {
+			kept = append(kept, pl)
+		}
+	}
+	return kept
+}
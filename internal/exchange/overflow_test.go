@@ -0,0 +1,139 @@
+package exchange
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSendDropOldest(t *testing.T) {
+	var counters Counters
+	ch := make(chan []*Trade, 2)
+	for _, id := range []int64{1, 2, 3} {
+		if !SendTrades(ch, []*Trade{{TradeID: id}}, DropOldest, &counters) {
+			t.Fatalf("send %d asked to disconnect", id)
+		}
+	}
+	if got := counters.Dropped(); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+	for _, want := range []int64{2, 3} {
+		if got := (<-ch)[0].TradeID; got != want {
+			t.Errorf("trade = %d, want %d", got, want)
+		}
+	}
+}
+
+func TestSendCoalesce(t *testing.T) {
+	var counters Counters
+	ch := make(chan []*Trade, 2)
+	for _, id := range []int64{1, 2, 3} {
+		SendTrades(ch, []*Trade{{TradeID: id}}, Coalesce, &counters)
+	}
+	if got := counters.Coalesced(); got != 2 {
+		t.Errorf("coalesced = %d, want 2", got)
+	}
+	if len(ch) != 1 {
+		t.Fatalf("buffered = %d, want 1", len(ch))
+	}
+	var ids []int64
+	for _, trade := range <-ch {
+		ids = append(ids, trade.TradeID)
+	}
+	if want := []int64{1, 2, 3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("trades = %v, want %v", ids, want)
+	}
+}
+
+func TestSendDisconnect(t *testing.T) {
+	var counters Counters
+	ch := make(chan *Ticker, 1)
+	if !SendLatest(ch, &Ticker{BidPrice: "1"}, Disconnect, &counters) {
+		t.Fatal("send with room asked to disconnect")
+	}
+	if SendLatest(ch, &Ticker{BidPrice: "2"}, Disconnect, &counters) {
+		t.Error("send when full didn't ask to disconnect")
+	}
+	if got := counters.Dropped(); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+	if got := (<-ch).BidPrice; got != "1" {
+		t.Errorf("ticker = %s, want 1", got)
+	}
+}
+
+func TestSendLatest(t *testing.T) {
+	var counters Counters
+	ch := make(chan *Ticker, 1)
+	for _, price := range []string{"1", "2", "3"} {
+		SendLatest(ch, &Ticker{BidPrice: price}, Coalesce, &counters)
+	}
+	if got := (<-ch).BidPrice; got != "3" {
+		t.Errorf("ticker = %s, want 3", got)
+	}
+}
+
+// Book updates aren't to be dropped, the book going wrong without them.
+func TestSendBookDropOldest(t *testing.T) {
+	var counters Counters
+	ch := make(chan *BookUpdate, 1)
+	SendBook(ch, &BookUpdate{Bids: []PriceLevelUpdate{{Price: "1", Quantity: "1"}}}, DropOldest, &counters)
+	SendBook(ch, &BookUpdate{Bids: []PriceLevelUpdate{{Price: "2", Quantity: "1"}}}, DropOldest, &counters)
+	if got := counters.Dropped(); got != 0 {
+		t.Errorf("dropped = %d, want 0", got)
+	}
+	if got := len((<-ch).Bids); got != 2 {
+		t.Errorf("bids = %d, want 2", got)
+	}
+}
+
+func TestMergeBook(t *testing.T) {
+	a := &BookUpdate{
+		Timestamp: 1,
+		Bids:      []PriceLevelUpdate{{Price: "10", Quantity: "1"}, {Price: "9", Quantity: "1"}},
+		Asks:      []PriceLevelUpdate{{Price: "11", Quantity: "1"}},
+		Kind:      Snapshot,
+	}
+	b := &BookUpdate{
+		Timestamp: 2,
+		Bids:      []PriceLevelUpdate{{Price: "10", Quantity: "0"}, {Price: "8", Quantity: "2"}},
+		Kind:      Delta,
+	}
+	got := mergeBook(a, b)
+	want := &BookUpdate{
+		Timestamp: 2,
+		Bids:      []PriceLevelUpdate{{Price: "9", Quantity: "1"}, {Price: "8", Quantity: "2"}},
+		Asks:      []PriceLevelUpdate{{Price: "11", Quantity: "1"}},
+		Kind:      Snapshot,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged = %+v, want %+v", got, want)
+	}
+
+	// Deltas merged keep levels removed.
+	d := &BookUpdate{Timestamp: 1, Bids: []PriceLevelUpdate{{Price: "10", Quantity: "1"}}, Kind: Delta}
+	got = mergeBook(d, b)
+	want = &BookUpdate{
+		Timestamp: 2,
+		Bids:      []PriceLevelUpdate{{Price: "10", Quantity: "0"}, {Price: "8", Quantity: "2"}},
+		Kind:      Delta,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged deltas = %+v, want %+v", got, want)
+	}
+
+	// Resets stay bare.
+	r := &BookUpdate{Timestamp: 1, Kind: Reset}
+	got = mergeBook(r, b)
+	want = &BookUpdate{Timestamp: 2, Kind: Reset}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged with reset = %+v, want %+v", got, want)
+	}
+
+	// Snapshots and resets take place of whatever came before.
+	for _, kind := range []UpdateKind{Snapshot, Reset} {
+		c := &BookUpdate{Timestamp: 3, Kind: kind}
+		if got := mergeBook(a, c); got != c {
+			t.Errorf("merged with %v = %+v, want %+v", kind, got, c)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package features
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/book"
+	"github.com/oerlikon/sounding/internal/common/outbox"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Features are derived from an exchange's book for a symbol at some point.
+type Features struct {
+	Exchange string
+	Symbol   string
+
+	Timestamp timestamp.T // Of the update, or the time sampled at.
+	Received  timestamp.T
+
+	Mid         float64
+	Spread      float64
+	SpreadTicks float64 // 0 if tick size isn't known.
+	Microprice  float64 // Mid weighted by quantities at best bid and ask, towards the side with less.
+	Imbalance   float64 // Bid less ask quantity over both, of top levels, -1 to 1.
+	BidDepth    float64 // Bid quantity within bps of mid.
+	AskDepth    float64 // Ask quantity within bps of mid.
+	BidSlope    float64 // Cumulative bid quantity per bps away from mid, over top levels.
+	AskSlope    float64 // Cumulative ask quantity per bps away from mid, over top levels.
+}
+
+// Extractor keeps books from updates passing through it and works out features
+// of them on every update or, if interval is set, every interval, on
+// wall-clock interval boundaries. Books with either side empty have none.
+type Extractor struct {
+	levels   int
+	bps      float64
+	interval time.Duration
+
+	mu       sync.Mutex
+	books    []*tracked
+	features *outbox.Outbox[[]*Features]
+	done     chan struct{}
+	closed   bool
+}
+
+type tracked struct {
+	*book.Book
+	tick float64
+}
+
+// NewExtractor makes an extractor with imbalance and slopes over levels top
+// levels on each side and depth within bps of mid, sampling every interval
+// if set, or on every update if not.
+func NewExtractor(levels int, bps float64, interval time.Duration) *Extractor {
+	e := &Extractor{
+		levels:   levels,
+		bps:      bps,
+		interval: interval,
+		features: outbox.New[[]*Features](16),
+		done:     make(chan struct{}),
+	}
+	if interval > 0 {
+		go e.clock()
+	}
+	return e
+}
+
+// Tap keeps books from updates coming from in, passing them through to the
+// returned channel. Spreads are given in ticks of tick size, if set. Books
+// are dropped once in gets closed.
+func (e *Extractor) Tap(in <-chan *exchange.BookUpdate, tick float64) <-chan *exchange.BookUpdate {
+	out := make(chan *exchange.BookUpdate, 1)
+	go func() {
+		defer close(out)
+		var books []*tracked
+		for bu := range in {
+			e.apply(&books, bu, tick)
+			out <- bu
+		}
+		e.drop(books)
+	}()
+	return out
+}
+
+// Features returns the channel features are sent to, those of all books
+// sampled at the same time in one batch.
+func (e *Extractor) Features() <-chan []*Features {
+	return e.features.C()
+}
+
+// Close stops working out features, closing the features channel.
+func (e *Extractor) Close() {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.done)
+	e.mu.Unlock()
+	e.features.Close()
+}
+
+func (e *Extractor) apply(books *[]*tracked, bu *exchange.BookUpdate, tick float64) {
+	e.mu.Lock()
+
+	var t *tracked
+	for _, b := range *books {
+		if b.Exchange == bu.Exchange && b.Symbol == bu.Symbol {
+			t = b
+			break
+		}
+	}
+	if t == nil {
+		t = &tracked{book.New(bu.Exchange, bu.Symbol), tick}
+		*books = append(*books, t)
+		e.books = append(e.books, t)
+	}
+	t.Apply(bu)
+	if e.interval > 0 || e.closed {
+		e.mu.Unlock()
+		return
+	}
+	f := e.extract(t)
+	if f == nil {
+		e.mu.Unlock()
+		return
+	}
+	e.features.Send([]*Features{f}, &e.mu)
+}
+
+func (e *Extractor) drop(books []*tracked) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	kept := e.books[:0]
+	for _, b := range e.books {
+		dropped := false
+		for _, d := range books {
+			if b == d {
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			kept = append(kept, b)
+		}
+	}
+	clear(e.books[len(kept):])
+	e.books = kept
+}
+
+func (e *Extractor) clock() {
+	for {
+		now := time.Now()
+		boundary := now.Truncate(e.interval).Add(e.interval)
+		timer := time.NewTimer(boundary.Sub(now))
+		select {
+		case <-timer.C:
+		case <-e.done:
+			timer.Stop()
+			return
+		}
+		e.sample(timestamp.Stamp(boundary))
+	}
+}
+
+func (e *Extractor) sample(ts timestamp.T) {
+	e.mu.Lock()
+
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	var ff []*Features
+	for _, t := range e.books {
+		if f := e.extract(t); f != nil {
+			f.Timestamp = ts
+			ff = append(ff, f)
+		}
+	}
+	if len(ff) == 0 {
+		e.mu.Unlock()
+		return
+	}
+	e.features.Send(ff, &e.mu)
+}
+
+// extract works out features of the book, nil if either side of it is empty.
+func (e *Extractor) extract(t *tracked) *Features {
+	bestBid, bid, ok := t.BestBid()
+	if !ok {
+		return nil
+	}
+	bestAsk, ask, ok := t.BestAsk()
+	if !ok {
+		return nil
+	}
+	bidQuantity, _ := strconv.ParseFloat(bestBid.Quantity, 64)
+	askQuantity, _ := strconv.ParseFloat(bestAsk.Quantity, 64)
+
+	f := &Features{
+		Exchange:  t.Exchange,
+		Symbol:    t.Symbol,
+		Timestamp: t.Timestamp,
+		Received:  t.Received,
+		Mid:       (bid + ask) / 2,
+		Spread:    ask - bid,
+	}
+	if t.tick > 0 {
+		f.SpreadTicks = f.Spread / t.tick
+	}
+	f.Microprice = f.Mid
+	if bidQuantity+askQuantity > 0 {
+		f.Microprice = (bid*askQuantity + ask*bidQuantity) / (bidQuantity + askQuantity)
+	}
+
+	within := f.Mid * e.bps / 1e4
+	t.WalkBids(func(pl exchange.PriceLevelUpdate, price float64) bool {
+		if price < f.Mid-within {
+			return false
+		}
+		quantity, _ := strconv.ParseFloat(pl.Quantity, 64)
+		f.BidDepth += quantity
+		return true
+	})
+	t.WalkAsks(func(pl exchange.PriceLevelUpdate, price float64) bool {
+		if price > f.Mid+within {
+			return false
+		}
+		quantity, _ := strconv.ParseFloat(pl.Quantity, 64)
+		f.AskDepth += quantity
+		return true
+	})
+
+	var bidTop, askTop float64
+	bidTop, f.BidSlope = e.ladder(t.Bids(e.levels), f.Mid)
+	askTop, f.AskSlope = e.ladder(t.Asks(e.levels), f.Mid)
+	if bidTop+askTop > 0 {
+		f.Imbalance = (bidTop - askTop) / (bidTop + askTop)
+	}
+	return f
+}
+
+// ladder returns total quantity of levels and slope of their cumulative
+// quantity against distance from mid in bps, fitted by least squares.
+func (e *Extractor) ladder(levels []exchange.PriceLevelUpdate, mid float64) (total, slope float64) {
+	var sx, sy, sxx, sxy float64
+	for _, pl := range levels {
+		price, _ := strconv.ParseFloat(pl.Price, 64)
+		quantity, _ := strconv.ParseFloat(pl.Quantity, 64)
+		total += quantity
+		x := (price - mid) / mid * 1e4
+		if x < 0 {
+			x = -x
+		}
+		sx += x
+		sy += total
+		sxx += x * x
+		sxy += x * total
+	}
+	n := float64(len(levels))
+	if d := n*sxx - sx*sx; n > 1 && d > 0 {
+		slope = (n*sxy - sx*sy) / d
+	}
+	return total, slope
+}
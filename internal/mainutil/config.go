@@ -0,0 +1,46 @@
+package mainutil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig reads YAML config at path into v and validates it. References to
+// environment variables like ${VAR} get expanded before the config is parsed.
+// Fields unknown to v are considered errors.
+func LoadConfig(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(strings.NewReader(os.ExpandEnv(b2s(data))))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return Validate(v)
+}
+
+// ParseEnv sets flags that haven't been set yet from environment variables
+// named like prefix + NAME, where NAME is the flag name upper-cased with
+// dashes replaced by underscores, e.g. SOUND_KRAKEN_V2 for --kraken-v2.
+func ParseEnv(flags *flag.FlagSet, prefix string) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Changed {
+			return
+		}
+		name := prefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok {
+			if e := flags.Set(f.Name, value); e != nil {
+				err = fmt.Errorf("invalid %s: %s", name, e)
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,17 @@
+package mainutil
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// Listen listens on a TCP address like host:port or, if given as unix:path,
+// on a unix socket, removing a stale one left at path first.
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		os.Remove(path)
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,136 @@
+package serve
+
+import (
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/oerlikon/sounding/feed"
+	"github.com/oerlikon/sounding/feed/feedpb"
+	"github.com/oerlikon/sounding/internal/broadcast"
+)
+
+// Server serves what it's handed as a feed handler to gRPC clients subscribed.
+// Every client has its own buffer of updates, and clients letting it fill up
+// get disconnected rather than holding up the others. Updates are handed out
+// by a broadcaster, so that clients get snapshots of the books they subscribe
+// to first.
+type Server struct {
+	feedpb.UnimplementedFeedServer
+
+	buffer      int
+	log         zerolog.Logger
+	broadcaster *broadcast.Broadcaster
+}
+
+func NewServer(buffer int, logger zerolog.Logger) *Server {
+	return &Server{
+		buffer:      buffer,
+		log:         logger,
+		broadcaster: broadcast.New(),
+	}
+}
+
+func (s *Server) Subscribe(req *feedpb.SubscribeRequest, stream feedpb.Feed_SubscribeServer) error {
+	filter := broadcast.Filter{
+		Exchanges: req.Exchanges,
+		Symbols:   req.Symbols,
+		Books:     len(req.Streams) == 0,
+		Trades:    len(req.Streams) == 0,
+	}
+	for _, st := range req.Streams {
+		switch st {
+		case feedpb.Stream_STREAM_BOOKS:
+			filter.Books = true
+		case feedpb.Stream_STREAM_TRADES:
+			filter.Trades = true
+		default:
+			return status.Errorf(codes.InvalidArgument, "unknown stream %d", st)
+		}
+	}
+
+	sub := s.broadcaster.Subscribe(filter, s.buffer, broadcast.Disconnect)
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case u, ok := <-sub.Updates():
+			if !ok {
+				if !sub.Disconnected() {
+					return status.Error(codes.Unavailable, "server closing")
+				}
+				s.log.Warn().Msg("Dropping slow client")
+				return status.Error(codes.ResourceExhausted, "client too slow")
+			}
+			if err := stream.Send(update(u)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (s *Server) OnBook(bu *feed.BookUpdate) {
+	s.broadcaster.OnBook(bu)
+}
+
+func (s *Server) OnTrade(trades []*feed.Trade) {
+	s.broadcaster.OnTrade(trades)
+}
+
+// OnEvent ignores events, which aren't served.
+func (s *Server) OnEvent(event feed.Event) {}
+
+// Close disconnects all clients.
+func (s *Server) Close() {
+	s.broadcaster.Close()
+}
+
+func update(u broadcast.Update) *feedpb.Update {
+	if u.Book != nil {
+		return &feedpb.Update{Update: &feedpb.Update_Book{Book: bookUpdate(u.Book)}}
+	}
+	return &feedpb.Update{Update: &feedpb.Update_Trades{Trades: tradeUpdates(u.Trades)}}
+}
+
+func bookUpdate(bu *feed.BookUpdate) *feedpb.BookUpdate {
+	return &feedpb.BookUpdate{
+		Exchange:  bu.Exchange,
+		Symbol:    bu.Symbol,
+		Timestamp: int64(bu.Timestamp),
+		Received:  int64(bu.Received),
+		Bids:      priceLevels(bu.Bids),
+		Asks:      priceLevels(bu.Asks),
+		Kind:      feedpb.BookKind(bu.Kind),
+	}
+}
+
+func priceLevels(pls []feed.PriceLevelUpdate) []*feedpb.PriceLevel {
+	levels := make([]*feedpb.PriceLevel, len(pls))
+	for i, pl := range pls {
+		levels[i] = &feedpb.PriceLevel{Price: pl.Price, Quantity: pl.Quantity}
+	}
+	return levels
+}
+
+func tradeUpdates(trades []*feed.Trade) *feedpb.Trades {
+	tu := &feedpb.Trades{Trades: make([]*feedpb.Trade, len(trades))}
+	for i, t := range trades {
+		tu.Trades[i] = &feedpb.Trade{
+			Exchange:    t.Exchange,
+			Symbol:      t.Symbol,
+			Timestamp:   int64(t.Timestamp),
+			Received:    int64(t.Received),
+			Occurred:    int64(t.Occurred),
+			TradeId:     t.TradeID,
+			BuyOrderId:  t.BuyOrderID,
+			SellOrderId: t.SellOrderID,
+			Price:       t.Price,
+			Quantity:    t.Quantity,
+			Taker:       feedpb.Side(t.Taker),
+			Amended:     t.Amended,
+		}
+	}
+	return tu
+}
@@ -0,0 +1,258 @@
+package tape
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oerlikon/sounding/internal/common/outbox"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Stats are of trades of an exchange's symbol over a rolling window.
+type Stats struct {
+	Exchange string
+	Symbol   string
+
+	Timestamp timestamp.T // End of the window.
+	Window    time.Duration
+
+	Trades      int
+	Volume      float64
+	BuyVolume   float64 // Of trades with buyer for taker.
+	SellVolume  float64 // Of trades with seller for taker.
+	VWAP        float64
+	AverageSize float64
+	LargeTrades int     // Trades of large size or above, if set.
+	Imbalance   float64 // Buy less sell volume over volume, -1 to 1.
+}
+
+// Tape keeps trades passing through it over a rolling window for every
+// exchange and symbol it sees, sending stats of them every interval, on
+// wall-clock interval boundaries.
+type Tape struct {
+	window   time.Duration
+	interval time.Duration
+	large    float64
+
+	mu     sync.Mutex
+	venues map[venue]*rolling
+	stats  *outbox.Outbox[[]*Stats]
+	done   chan struct{}
+	closed bool
+}
+
+type venue struct {
+	exchange string
+	symbol   string
+}
+
+// rolling has trades in the window, oldest first.
+type rolling struct {
+	trades []trade
+}
+
+type trade struct {
+	id       int64
+	ts       timestamp.T
+	price    float64
+	quantity float64
+	taker    exchange.Side
+}
+
+// NewTape makes a tape with stats over window, sent every interval. Trades of
+// large size or above are counted, unless large is 0.
+func NewTape(window, interval time.Duration, large float64) *Tape {
+	t := &Tape{
+		window:   window,
+		interval: interval,
+		large:    large,
+		venues:   make(map[venue]*rolling),
+		stats:    outbox.New[[]*Stats](1),
+		done:     make(chan struct{}),
+	}
+	go t.clock()
+	return t
+}
+
+// Tap keeps trades coming from in, passing them through to the returned channel.
+func (t *Tape) Tap(in <-chan []*exchange.Trade) <-chan []*exchange.Trade {
+	out := make(chan []*exchange.Trade, 1)
+	go func() {
+		defer close(out)
+		for trades := range in {
+			t.add(trades)
+			out <- trades
+		}
+	}()
+	return out
+}
+
+// Stats returns the channel stats are sent to, those of all exchanges and
+// symbols with trades in the window in one batch. Stats have the time they're
+// sent at for timestamp.
+func (t *Tape) Stats() <-chan []*Stats {
+	return t.stats.C()
+}
+
+// Current returns stats of trades of exchange and symbol over the window up
+// to now, nil if none seen.
+func (t *Tape) Current(exch, symbol string) *Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	v := venue{exch, symbol}
+	w := t.venues[v]
+	if w == nil {
+		return nil
+	}
+	now := timestamp.Stamp(time.Now())
+	w.evict(now.Add(-t.window))
+	return t.current(v, w, now)
+}
+
+// Close stops sending stats, closing the stats channel.
+func (t *Tape) Close() {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	close(t.done)
+	t.mu.Unlock()
+	t.stats.Close()
+}
+
+func (t *Tape) add(trades []*exchange.Trade) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tr := range trades {
+		price, err := strconv.ParseFloat(tr.Price, 64)
+		if err != nil {
+			continue
+		}
+		quantity, err := strconv.ParseFloat(tr.Quantity, 64)
+		if err != nil {
+			continue
+		}
+		ts := tr.Occurred
+		if ts == 0 {
+			ts = tr.Timestamp
+		}
+		v := venue{tr.Exchange, tr.Symbol}
+		w := t.venues[v]
+		if w == nil {
+			w = &rolling{}
+			t.venues[v] = w
+		}
+		if tr.Amended {
+			w.amend(trade{tr.TradeID, ts, price, quantity, tr.Taker})
+			continue
+		}
+		w.trades = append(w.trades, trade{tr.TradeID, ts, price, quantity, tr.Taker})
+	}
+}
+
+// amend replaces the trade with the same id, if still in the window, keeping
+// its place.
+func (w *rolling) amend(tr trade) {
+	for i := len(w.trades) - 1; i >= 0; i-- {
+		if w.trades[i].id == tr.id {
+			tr.ts = w.trades[i].ts
+			w.trades[i] = tr
+			return
+		}
+	}
+}
+
+// evict drops trades before start. Late trades, arriving out of order, go
+// once those before them do.
+func (w *rolling) evict(start timestamp.T) {
+	n := 0
+	for n < len(w.trades) && w.trades[n].ts < start {
+		n++
+	}
+	if n > 0 {
+		w.trades = append(w.trades[:0], w.trades[n:]...)
+	}
+}
+
+// current works out stats of trades in the window, totals summed up anew
+// every time for float errors not to pile up.
+func (t *Tape) current(v venue, w *rolling, ts timestamp.T) *Stats {
+	st := &Stats{
+		Exchange:  v.exchange,
+		Symbol:    v.symbol,
+		Timestamp: ts,
+		Window:    t.window,
+		Trades:    len(w.trades),
+	}
+	var cost float64
+	for _, tr := range w.trades {
+		st.Volume += tr.quantity
+		cost += tr.price * tr.quantity
+		if tr.taker == exchange.Buy {
+			st.BuyVolume += tr.quantity
+		} else {
+			st.SellVolume += tr.quantity
+		}
+		if t.large > 0 && tr.quantity >= t.large {
+			st.LargeTrades++
+		}
+	}
+	if st.Trades > 0 {
+		st.AverageSize = st.Volume / float64(st.Trades)
+	}
+	if st.Volume > 0 {
+		st.VWAP = cost / st.Volume
+		st.Imbalance = (st.BuyVolume - st.SellVolume) / st.Volume
+	}
+	return st
+}
+
+func (t *Tape) clock() {
+	for {
+		now := time.Now()
+		boundary := now.Truncate(t.interval).Add(t.interval)
+		timer := time.NewTimer(boundary.Sub(now))
+		select {
+		case <-timer.C:
+		case <-t.done:
+			timer.Stop()
+			return
+		}
+		t.tick(timestamp.Stamp(boundary))
+	}
+}
+
+func (t *Tape) tick(ts timestamp.T) {
+	t.mu.Lock()
+
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	var stats []*Stats
+	for v, w := range t.venues {
+		w.evict(ts.Add(-t.window))
+		if len(w.trades) == 0 {
+			continue
+		}
+		stats = append(stats, t.current(v, w, ts))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Exchange != stats[j].Exchange {
+			return stats[i].Exchange < stats[j].Exchange
+		}
+		return stats[i].Symbol < stats[j].Symbol
+	})
+	if len(stats) == 0 {
+		t.mu.Unlock()
+		return
+	}
+	t.stats.Send(stats, &t.mu)
+}
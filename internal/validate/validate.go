@@ -0,0 +1,266 @@
+package validate
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/oerlikon/sounding/internal/book"
+	"github.com/oerlikon/sounding/internal/common/outbox"
+	"github.com/oerlikon/sounding/internal/common/timestamp"
+	"github.com/oerlikon/sounding/internal/exchange"
+)
+
+// Checks issues are found by.
+const (
+	Crossed        = "crossed"         // Best bid above best ask.
+	Locked         = "locked"          // Best bid at best ask.
+	Malformed      = "malformed"       // Price or quantity not a number, or price not positive.
+	Negative       = "negative"        // Quantity below zero.
+	OutsideBBO     = "outside_bbo"     // Trade price outside best bid and ask, of a book at least as new as the trade.
+	TimeRegression = "time_regression" // Timestamp before the previous one of the same stream.
+)
+
+var Checks = []string{Crossed, Locked, Malformed, Negative, OutsideBBO, TimeRegression}
+
+type Issue struct {
+	Exchange string
+	Symbol   string
+
+	Timestamp timestamp.T // Of the update or trade found wrong.
+	Received  timestamp.T
+
+	Check  string
+	Detail string
+}
+
+// Validator keeps books from updates passing through it and checks them along
+// with trades, sending issues found to its issues channel and counting them.
+// Books found crossed or locked can be resynced, checks of a book resynced
+// resuming once its snapshot comes.
+type Validator struct {
+	mu     sync.Mutex
+	books  map[venue]*state
+	counts map[venue]map[string]int64
+	issues *outbox.Outbox[[]*Issue]
+}
+
+type venue struct {
+	exchange string
+	symbol   string
+}
+
+type state struct {
+	book      *book.Book
+	resyncing bool // Till snapshot comes.
+
+	bookTime  timestamp.T
+	tradeTime timestamp.T
+}
+
+func NewValidator() *Validator {
+	return &Validator{
+		books:  make(map[venue]*state),
+		counts: make(map[venue]map[string]int64),
+		issues: outbox.New[[]*Issue](16),
+	}
+}
+
+// Books checks book updates coming from in, passing them through to the
+// returned channel. If resync is given, it gets called when the book is found
+// crossed or locked.
+func (v *Validator) Books(in <-chan *exchange.BookUpdate, resync func()) <-chan *exchange.BookUpdate {
+	out := make(chan *exchange.BookUpdate, 1)
+	go func() {
+		defer close(out)
+		for bu := range in {
+			v.checkBook(bu, resync)
+			out <- bu
+		}
+	}()
+	return out
+}
+
+// Trades checks trades coming from in against books and each other, passing
+// them through to the returned channel.
+func (v *Validator) Trades(in <-chan []*exchange.Trade) <-chan []*exchange.Trade {
+	out := make(chan []*exchange.Trade, 1)
+	go func() {
+		defer close(out)
+		for trades := range in {
+			v.checkTrades(trades)
+			out <- trades
+		}
+	}()
+	return out
+}
+
+// Issues returns the channel issues are sent to, those found at once in one batch.
+func (v *Validator) Issues() <-chan []*Issue {
+	return v.issues.C()
+}
+
+// Counts returns numbers of issues found so far for exchange and symbol by check.
+func (v *Validator) Counts(exch, symbol string) map[string]int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	counts := make(map[string]int64, len(Checks))
+	for check, n := range v.counts[venue{exch, symbol}] {
+		counts[check] = n
+	}
+	return counts
+}
+
+// Close stops sending issues, closing the issues channel. Counting goes on.
+func (v *Validator) Close() {
+	v.issues.Close()
+}
+
+func (v *Validator) checkBook(bu *exchange.BookUpdate, resync func()) {
+	v.mu.Lock()
+
+	var issues []*Issue
+	found := func(check, format string, args ...interface{}) {
+		issues = append(issues, &Issue{
+			Exchange:  bu.Exchange,
+			Symbol:    bu.Symbol,
+			Timestamp: bu.Timestamp,
+			Received:  bu.Received,
+			Check:     check,
+			Detail:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	st := v.state(bu.Exchange, bu.Symbol)
+	switch bu.Kind {
+	case exchange.Snapshot:
+		st.resyncing = false
+		st.bookTime = 0 // Updates buffered till snapshot may be older.
+	case exchange.Reset:
+		st.bookTime = 0
+	default:
+		if bu.Timestamp < st.bookTime {
+			found(TimeRegression, "book %s after %s", formatTime(bu.Timestamp), formatTime(st.bookTime))
+		}
+	}
+	if bu.Timestamp > st.bookTime {
+		st.bookTime = bu.Timestamp
+	}
+	for _, ll := range [][]exchange.PriceLevelUpdate{bu.Bids, bu.Asks} {
+		for _, pl := range ll {
+			price, err := strconv.ParseFloat(pl.Price, 64)
+			if err != nil || price <= 0 {
+				found(Malformed, "price %q", pl.Price)
+				continue
+			}
+			quantity, err := strconv.ParseFloat(pl.Quantity, 64)
+			if err != nil {
+				found(Malformed, "quantity %q at %s", pl.Quantity, pl.Price)
+				continue
+			}
+			if quantity < 0 {
+				found(Negative, "quantity %s at %s", pl.Quantity, pl.Price)
+			}
+		}
+	}
+	st.book.Apply(bu)
+
+	if !st.resyncing {
+		if bid, ask, ok := st.book.Best(); ok && bid >= ask {
+			if bid > ask {
+				found(Crossed, "bid %g above ask %g", bid, ask)
+			} else {
+				found(Locked, "bid and ask at %g", bid)
+			}
+			if resync != nil {
+				st.resyncing = true
+				resync()
+			}
+		}
+	}
+	v.report(issues)
+}
+
+func (v *Validator) checkTrades(trades []*exchange.Trade) {
+	v.mu.Lock()
+
+	var issues []*Issue
+	for _, trade := range trades {
+		found := func(check, format string, args ...interface{}) {
+			issues = append(issues, &Issue{
+				Exchange:  trade.Exchange,
+				Symbol:    trade.Symbol,
+				Timestamp: trade.Timestamp,
+				Received:  trade.Received,
+				Check:     check,
+				Detail:    fmt.Sprintf(format, args...),
+			})
+		}
+		st := v.state(trade.Exchange, trade.Symbol)
+		if !trade.Amended {
+			if trade.Timestamp < st.tradeTime {
+				found(TimeRegression, "trade %s after %s", formatTime(trade.Timestamp), formatTime(st.tradeTime))
+			} else {
+				st.tradeTime = trade.Timestamp
+			}
+		}
+		price, err := strconv.ParseFloat(trade.Price, 64)
+		if err != nil || price <= 0 {
+			found(Malformed, "trade price %q", trade.Price)
+			continue
+		}
+		quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+		if err != nil {
+			found(Malformed, "trade quantity %q", trade.Quantity)
+			continue
+		}
+		if quantity < 0 {
+			found(Negative, "trade quantity %s", trade.Quantity)
+		}
+		if trade.Amended || st.resyncing {
+			continue
+		}
+		// Trades and book updates come in separately, a trade sweeping levels
+		// often coming ahead of the book updates removing them. Trades are
+		// checked against books at least as new only, those newer than the
+		// book going unchecked.
+		if st.book.Timestamp < trade.Timestamp {
+			continue
+		}
+		if bid, ask, ok := st.book.Best(); ok && bid < ask && (price < bid || price > ask) {
+			found(OutsideBBO, "trade at %s outside %g-%g", trade.Price, bid, ask)
+		}
+	}
+	v.report(issues)
+}
+
+func (v *Validator) state(exch, symbol string) *state {
+	st := v.books[venue{exch, symbol}]
+	if st == nil {
+		st = &state{book: book.New(exch, symbol)}
+		v.books[venue{exch, symbol}] = st
+	}
+	return st
+}
+
+// report counts issues and sends them to the issues channel. Called with mu
+// held, unlocks it.
+func (v *Validator) report(issues []*Issue) {
+	if len(issues) == 0 {
+		v.mu.Unlock()
+		return
+	}
+	for _, issue := range issues {
+		key := venue{issue.Exchange, issue.Symbol}
+		if v.counts[key] == nil {
+			v.counts[key] = make(map[string]int64, len(Checks))
+		}
+		v.counts[key][issue.Check]++
+	}
+	v.issues.Send(issues, &v.mu)
+}
+
+func formatTime(ts timestamp.T) string {
+	return ts.Format("15:04:05.000")
+}